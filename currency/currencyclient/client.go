@@ -0,0 +1,389 @@
+package currencyclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/SArtemJ/CurrencyGameExample/currency/money"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+const (
+	DefaultTimeout = time.Second * 10
+)
+
+var (
+	// ErrNoRate - сервер вернул нулевой курс (пара еще не обновлялась)
+	ErrNoRate = errors.New("currencyclient: rate is not available yet")
+)
+
+/*
+API
+методы HTTP API сервиса currency
+*/
+type API interface {
+	Rate(ctx context.Context, pair string) (money.Amount, error)
+	Rates(ctx context.Context) (map[string]money.Amount, error)
+	Snapshot(ctx context.Context, pairs ...string) (*Snapshot, error)
+	Update(ctx context.Context, pair string) error
+	UpdateAll(ctx context.Context) error
+	History(ctx context.Context, pair string, from, to time.Time) ([]RatePoint, error)
+	Convert(ctx context.Context, amount money.Amount, from, to string) (*Conversion, error)
+	Currencies(ctx context.Context) ([]Currency, error)
+}
+
+/*
+Snapshot
+курсы нескольких пар из одного обновления
+Version - номер версии курсов на сервере, одинаковый Version - одинаковые значения
+Overridden - пары курс которых зафиксирован вручную
+*/
+type Snapshot struct {
+	Version    int64                   `json:"version"`
+	Rates      map[string]money.Amount `json:"rates"`
+	Overridden []string                `json:"overridden,omitempty"`
+}
+
+/*
+Rate
+курс пары из снимка, ErrNoRate - если пары нет или курс нулевой
+*/
+func (s *Snapshot) Rate(pair string) (money.Amount, error) {
+	v, ok := s.Rates[pair]
+	if !ok || v.IsZero() {
+		return money.Zero, ErrNoRate
+	}
+	return v, nil
+}
+
+/*
+Conversion
+результат пересчета суммы Amount из валюты From в валюту To
+Path - пары через которые получен курс
+*/
+type Conversion struct {
+	From    string       `json:"from"`
+	To      string       `json:"to"`
+	Amount  money.Amount `json:"amount"`
+	Rate    money.Amount `json:"rate"`
+	Result  money.Amount `json:"result"`
+	Path    []string     `json:"path"`
+	Version int64        `json:"version"`
+}
+
+/*
+Currency
+сведения о валюте из таблицы валют сервиса - название, символ, количество знаков после запятой
+*/
+type Currency struct {
+	Code       string `json:"code"`
+	Numeric    string `json:"numeric,omitempty"`
+	Name       string `json:"name"`
+	Symbol     string `json:"symbol"`
+	MinorUnits int32  `json:"minor_units"`
+	Crypto     bool   `json:"crypto"`
+}
+
+type RatePoint struct {
+	Time  time.Time    `json:"time"`
+	Value money.Amount `json:"value"`
+}
+
+/*
+ImportSummary
+итог импорта истории
+*/
+type ImportSummary struct {
+	Pair     string   `json:"pair"`
+	Read     int      `json:"read"`
+	Inserted int      `json:"inserted"`
+	Skipped  int      `json:"skipped"`
+	Invalid  int      `json:"invalid"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+/*
+APIError
+сервер ответил статусом отличным от 200
+*/
+type APIError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("currencyclient: %s %s: %d %s", e.Method, e.Path, e.StatusCode, e.Message)
+}
+
+/*
+IsStatus
+проверяет что ошибка - ответ сервера с кодом code
+*/
+func IsStatus(err error, code int) bool {
+	apiErr, ok := err.(*APIError)
+	return ok && apiErr.StatusCode == code
+}
+
+/*
+Client
+HTTP клиент сервиса currency
+контекст трассы передается в заголовке traceparent
+BaseURL - адрес API вместе с префиксом (http://currency_app_1:8888/api/)
+AdminToken - токен для административных методов (заголовок Authorization: Bearer)
+*/
+type Client struct {
+	BaseURL    string
+	AdminToken string
+	HTTPClient *http.Client
+}
+
+func NewClient(baseURL string, timeout time.Duration) *Client {
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: timeout, Transport: otelhttp.NewTransport(http.DefaultTransport)},
+	}
+}
+
+func (c *Client) authorize(req *http.Request) {
+	if c.AdminToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.AdminToken)
+	}
+}
+
+func (c *Client) do(ctx context.Context, method, path string, out interface{}) error {
+	req, err := http.NewRequest(method, c.BaseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	c.authorize(req)
+
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		return &APIError{
+			Method:     method,
+			Path:       path,
+			StatusCode: res.StatusCode,
+			Message:    strings.TrimSpace(string(body)),
+		}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("currencyclient: %s %s: bad response: %v", method, path, err)
+	}
+	return nil
+}
+
+/*
+Rate
+GET /currency/{pair}
+*/
+func (c *Client) Rate(ctx context.Context, pair string) (money.Amount, error) {
+	var data struct {
+		Value money.Amount `json:"value"`
+	}
+	if err := c.do(ctx, "GET", "/currency/"+url.PathEscape(pair), &data); err != nil {
+		return money.Zero, err
+	}
+	if data.Value.IsZero() {
+		return money.Zero, ErrNoRate
+	}
+	return data.Value, nil
+}
+
+/*
+Rates
+GET /currencyall
+*/
+func (c *Client) Rates(ctx context.Context) (map[string]money.Amount, error) {
+	var all Snapshot
+	if err := c.do(ctx, "GET", "/currencyall", &all); err != nil {
+		return nil, err
+	}
+	return all.Rates, nil
+}
+
+/*
+Snapshot
+GET /currency?types=BTCUSD,BTCEUR
+*/
+func (c *Client) Snapshot(ctx context.Context, pairs ...string) (*Snapshot, error) {
+	q := url.Values{}
+	q.Set("types", strings.Join(pairs, ","))
+	var snapshot Snapshot
+	if err := c.do(ctx, "GET", "/currency?"+q.Encode(), &snapshot); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+/*
+Currencies
+GET /currencies
+*/
+func (c *Client) Currencies(ctx context.Context) ([]Currency, error) {
+	var currencies []Currency
+	if err := c.do(ctx, "GET", "/currencies", &currencies); err != nil {
+		return nil, err
+	}
+	return currencies, nil
+}
+
+/*
+Update
+PATCH /update/{pair}
+*/
+func (c *Client) Update(ctx context.Context, pair string) error {
+	return c.do(ctx, "PATCH", "/update/"+url.PathEscape(pair), nil)
+}
+
+/*
+UpdateAll
+PATCH /updateall
+*/
+func (c *Client) UpdateAll(ctx context.Context) error {
+	return c.do(ctx, "PATCH", "/updateall", nil)
+}
+
+/*
+History
+GET /history/{pair}?from=&to=
+*/
+func (c *Client) History(ctx context.Context, pair string, from, to time.Time) ([]RatePoint, error) {
+	q := url.Values{}
+	if !from.IsZero() {
+		q.Set("from", from.UTC().Format(time.RFC3339))
+	}
+	if !to.IsZero() {
+		q.Set("to", to.UTC().Format(time.RFC3339))
+	}
+	path := "/history/" + url.PathEscape(pair)
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+
+	var points []RatePoint
+	if err := c.do(ctx, "GET", path, &points); err != nil {
+		return nil, err
+	}
+	return points, nil
+}
+
+/*
+ExportHistory
+GET /history/{pair}/export?format=csv|jsonl&from=&to=
+возвращает тело ответа для построчного чтения, закрывает вызывающий
+таймаут клиента не применяется - выгрузка может быть долгой, ограничивается ctx
+*/
+func (c *Client) ExportHistory(ctx context.Context, pair, format string, from, to time.Time) (io.ReadCloser, error) {
+	q := url.Values{}
+	q.Set("format", format)
+	if !from.IsZero() {
+		q.Set("from", from.UTC().Format(time.RFC3339))
+	}
+	if !to.IsZero() {
+		q.Set("to", to.UTC().Format(time.RFC3339))
+	}
+	path := "/history/" + url.PathEscape(pair) + "/export?" + q.Encode()
+
+	req, err := http.NewRequest("GET", c.BaseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.authorize(req)
+	client := &http.Client{Transport: c.HTTPClient.Transport}
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		body, _ := ioutil.ReadAll(res.Body)
+		return nil, &APIError{
+			Method:     "GET",
+			Path:       path,
+			StatusCode: res.StatusCode,
+			Message:    strings.TrimSpace(string(body)),
+		}
+	}
+	return res.Body, nil
+}
+
+/*
+ImportHistory
+POST /history/{pair}/import
+body - CSV (time,pair,value или time,value), нужен AdminToken
+*/
+func (c *Client) ImportHistory(ctx context.Context, pair string, body io.Reader) (*ImportSummary, error) {
+	path := "/history/" + url.PathEscape(pair) + "/import"
+	req, err := http.NewRequest("POST", c.BaseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/csv")
+	c.authorize(req)
+	client := &http.Client{Transport: c.HTTPClient.Transport}
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, &APIError{
+			Method:     "POST",
+			Path:       path,
+			StatusCode: res.StatusCode,
+			Message:    strings.TrimSpace(string(b)),
+		}
+	}
+	var summary ImportSummary
+	if err := json.Unmarshal(b, &summary); err != nil {
+		return nil, fmt.Errorf("currencyclient: POST %s: bad response: %v", path, err)
+	}
+	return &summary, nil
+}
+
+/*
+Convert
+GET /convert?from=ETH&to=RUB&amount=1.5
+*/
+func (c *Client) Convert(ctx context.Context, amount money.Amount, from, to string) (*Conversion, error) {
+	q := url.Values{}
+	q.Set("from", from)
+	q.Set("to", to)
+	q.Set("amount", amount.String())
+	var conversion Conversion
+	if err := c.do(ctx, "GET", "/convert?"+q.Encode(), &conversion); err != nil {
+		return nil, err
+	}
+	return &conversion, nil
+}
@@ -0,0 +1,150 @@
+package currencyclient
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SArtemJ/CurrencyGameExample/currency/money"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/currency/BTCUSD", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"value":6512.37}`)
+	})
+	mux.HandleFunc("/api/currency/BTCRUB", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"value":0}`)
+	})
+	mux.HandleFunc("/api/currency/XXXYYY", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "Bad request incorrect type currency")
+	})
+	mux.HandleFunc("/api/currencyall", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"rates":{"BTCUSD":6512.37,"BTCEUR":5570.11},"overridden":["BTCEUR"]}`)
+	})
+	mux.HandleFunc("/api/currency", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("types") != "BTCUSD,BTCEUR" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		io.WriteString(w, `{"version":42,"rates":{"BTCUSD":6512.37,"BTCEUR":0}}`)
+	})
+	mux.HandleFunc("/api/currencies", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `[{"code":"BTC","name":"Bitcoin","symbol":"₿","minor_units":8,"crypto":true},{"code":"USD","numeric":"840","name":"US Dollar","symbol":"$","minor_units":2,"crypto":false}]`)
+	})
+	mux.HandleFunc("/api/history/BTCUSD", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `[{"time":"2018-07-16T10:00:00Z","value":6500.1}]`)
+	})
+	mux.HandleFunc("/api/history/BTCUSD/export", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("format") != "csv" {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, "Bad request incorrect format - csv or jsonl")
+			return
+		}
+		io.WriteString(w, "time,pair,value\n2018-07-16T10:00:00Z,BTCUSD,6500.1\n")
+	})
+	mux.HandleFunc("/api/history/BTCUSD/import", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, "Bad admin token")
+			return
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		if string(b) != "time,value\n1531735200,6500.1\n" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		io.WriteString(w, `{"pair":"BTCUSD","read":1,"inserted":1,"skipped":0,"invalid":0}`)
+	})
+	mux.HandleFunc("/api/convert", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("from") != "ETH" || r.FormValue("to") != "RUB" || r.FormValue("amount") != "1.5" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		io.WriteString(w, `{"from":"ETH","to":"RUB","amount":1.5,"rate":30000,"result":45000,"path":["ETHRUB"],"version":42}`)
+	})
+	mux.HandleFunc("/api/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond * 200)
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestClientRate(t *testing.T) {
+	ts := testServer()
+	defer ts.Close()
+	c := NewClient(ts.URL+"/api/", 0)
+
+	v, err := c.Rate(context.Background(), "BTCUSD")
+	require.NoError(t, err)
+	assert.Equal(t, "6512.37", v.String())
+
+	_, err = c.Rate(context.Background(), "BTCRUB")
+	assert.Equal(t, ErrNoRate, err)
+
+	_, err = c.Rate(context.Background(), "XXXYYY")
+	assert.True(t, IsStatus(err, http.StatusBadRequest))
+
+	rates, err := c.Rates(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(rates))
+
+	snapshot, err := c.Snapshot(context.Background(), "BTCUSD", "BTCEUR")
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), snapshot.Version)
+	v, err = snapshot.Rate("BTCUSD")
+	require.NoError(t, err)
+	assert.Equal(t, "6512.37", v.String())
+	_, err = snapshot.Rate("BTCEUR")
+	assert.Equal(t, ErrNoRate, err)
+
+	currencies, err := c.Currencies(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 2, len(currencies))
+	assert.Equal(t, Currency{Code: "BTC", Name: "Bitcoin", Symbol: "₿", MinorUnits: 8, Crypto: true}, currencies[0])
+
+	points, err := c.History(context.Background(), "BTCUSD", time.Now().Add(-time.Hour), time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(points))
+	assert.Equal(t, "6500.1", points[0].Value.String())
+
+	body, err := c.ExportHistory(context.Background(), "BTCUSD", "csv", time.Time{}, time.Time{})
+	require.NoError(t, err)
+	b, _ := ioutil.ReadAll(body)
+	body.Close()
+	assert.Equal(t, "time,pair,value\n2018-07-16T10:00:00Z,BTCUSD,6500.1\n", string(b))
+	_, err = c.ExportHistory(context.Background(), "BTCUSD", "xls", time.Time{}, time.Time{})
+	assert.True(t, IsStatus(err, http.StatusBadRequest))
+
+	_, err = c.ImportHistory(context.Background(), "BTCUSD", strings.NewReader("time,value\n1531735200,6500.1\n"))
+	assert.True(t, IsStatus(err, http.StatusUnauthorized))
+	c.AdminToken = "secret"
+	summary, err := c.ImportHistory(context.Background(), "BTCUSD", strings.NewReader("time,value\n1531735200,6500.1\n"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, summary.Inserted)
+
+	conversion, err := c.Convert(context.Background(), money.MustParse("1.5"), "ETH", "RUB")
+	require.NoError(t, err)
+	assert.Equal(t, "45000", conversion.Result.String())
+	assert.Equal(t, []string{"ETHRUB"}, conversion.Path)
+}
+
+func TestClientTimeout(t *testing.T) {
+	ts := testServer()
+	defer ts.Close()
+
+	c := NewClient(ts.URL+"/api", time.Millisecond*50)
+	assert.Error(t, c.do(context.Background(), "GET", "/slow", nil))
+
+	c = NewClient(ts.URL+"/api", 0)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	assert.Error(t, c.do(ctx, "GET", "/slow", nil))
+}
@@ -0,0 +1,167 @@
+package currencyclient
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/SArtemJ/CurrencyGameExample/currency/money"
+)
+
+/*
+Fake
+реализация API в памяти для тестов
+Values - текущие курсы, Points - история курсов
+Err - если задана, возвращается всеми методами
+Updates - пары для которых вызывался Update (пустая строка - UpdateAll)
+Catalog - таблица валют
+*/
+type Fake struct {
+	M       sync.Mutex
+	Values  map[string]money.Amount
+	Points  map[string][]RatePoint
+	Version int64
+	Err     error
+	Updates []string
+	Catalog []Currency
+}
+
+var _ API = (*Fake)(nil)
+var _ API = (*Client)(nil)
+
+func NewFake(values map[string]money.Amount) *Fake {
+	if values == nil {
+		values = map[string]money.Amount{}
+	}
+	return &Fake{
+		Values: values,
+		Points: map[string][]RatePoint{},
+	}
+}
+
+func (f *Fake) Set(pair string, value money.Amount) {
+	f.M.Lock()
+	defer f.M.Unlock()
+	f.Values[pair] = value
+	f.Version++
+	f.Points[pair] = append(f.Points[pair], RatePoint{Time: time.Now().UTC(), Value: value})
+}
+
+func (f *Fake) Rate(ctx context.Context, pair string) (money.Amount, error) {
+	f.M.Lock()
+	defer f.M.Unlock()
+	if f.Err != nil {
+		return money.Zero, f.Err
+	}
+	v, ok := f.Values[pair]
+	if !ok {
+		return money.Zero, &APIError{Method: "GET", Path: "/currency/" + pair, StatusCode: http.StatusBadRequest, Message: "Bad request incorrect type currency"}
+	}
+	if v.IsZero() {
+		return money.Zero, ErrNoRate
+	}
+	return v, nil
+}
+
+func (f *Fake) Rates(ctx context.Context) (map[string]money.Amount, error) {
+	f.M.Lock()
+	defer f.M.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	rates := make(map[string]money.Amount, len(f.Values))
+	for k, v := range f.Values {
+		rates[k] = v
+	}
+	return rates, nil
+}
+
+func (f *Fake) Snapshot(ctx context.Context, pairs ...string) (*Snapshot, error) {
+	f.M.Lock()
+	defer f.M.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	snapshot := &Snapshot{Version: f.Version, Rates: map[string]money.Amount{}}
+	for _, pair := range pairs {
+		v, ok := f.Values[pair]
+		if !ok {
+			return nil, &APIError{Method: "GET", Path: "/currency", StatusCode: http.StatusBadRequest, Message: "Bad request incorrect type currency " + pair}
+		}
+		snapshot.Rates[pair] = v
+	}
+	return snapshot, nil
+}
+
+func (f *Fake) Currencies(ctx context.Context) ([]Currency, error) {
+	f.M.Lock()
+	defer f.M.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	return append([]Currency(nil), f.Catalog...), nil
+}
+
+func (f *Fake) Update(ctx context.Context, pair string) error {
+	f.M.Lock()
+	defer f.M.Unlock()
+	if f.Err != nil {
+		return f.Err
+	}
+	if _, ok := f.Values[pair]; !ok {
+		return &APIError{Method: "PATCH", Path: "/update/" + pair, StatusCode: http.StatusBadRequest, Message: "Not exist type of currency"}
+	}
+	f.Updates = append(f.Updates, pair)
+	return nil
+}
+
+func (f *Fake) UpdateAll(ctx context.Context) error {
+	f.M.Lock()
+	defer f.M.Unlock()
+	if f.Err != nil {
+		return f.Err
+	}
+	f.Updates = append(f.Updates, "")
+	return nil
+}
+
+func (f *Fake) History(ctx context.Context, pair string, from, to time.Time) ([]RatePoint, error) {
+	f.M.Lock()
+	defer f.M.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	var points []RatePoint
+	for _, p := range f.Points[pair] {
+		if (!from.IsZero() && p.Time.Before(from)) || (!to.IsZero() && p.Time.After(to)) {
+			continue
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
+
+/*
+Convert
+пересчет только по прямому (fromto) или обратному (tofrom) курсу пары
+*/
+func (f *Fake) Convert(ctx context.Context, amount money.Amount, from, to string) (*Conversion, error) {
+	f.M.Lock()
+	defer f.M.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	conversion := &Conversion{From: from, To: to, Amount: amount, Version: f.Version}
+	if v, ok := f.Values[from+to]; ok && !v.IsZero() {
+		conversion.Rate = v
+		conversion.Path = []string{from + to}
+	} else if v, ok := f.Values[to+from]; ok && !v.IsZero() {
+		conversion.Rate, _ = money.New(1, 0).Div(v)
+		conversion.Path = []string{to + from}
+	} else {
+		return nil, &APIError{Method: "GET", Path: "/convert", StatusCode: http.StatusBadRequest, Message: "Bad request - no rates to convert " + from + " to " + to}
+	}
+	conversion.Result = amount.Mul(conversion.Rate).Round(to)
+	return conversion, nil
+}
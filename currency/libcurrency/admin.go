@@ -0,0 +1,23 @@
+package libcurrency
+
+import (
+	"net/http"
+
+	"github.com/SArtemJ/CurrencyGameExample/currency/service"
+)
+
+/*
+AdminOnly
+доступ к административным методам только с токеном admin.token (см. service.AdminOnly)
+*/
+func (server *CurrencyServer) AdminOnly(next http.HandlerFunc) http.HandlerFunc {
+	return service.AdminOnly(func() string { return server.AdminToken }, next)
+}
+
+/*
+isAdmin
+запрос с токеном администратора (Authorization: Bearer <admin.token>)
+*/
+func (server *CurrencyServer) isAdmin(r *http.Request) bool {
+	return service.IsAdmin(r, server.AdminToken)
+}
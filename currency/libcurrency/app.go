@@ -1,12 +1,15 @@
 package libcurrency
 
 import (
+	"context"
+	"os"
 	"strings"
+	"sync"
 
+	"github.com/SArtemJ/CurrencyGameExample/currency/service"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
-	"go.uber.org/zap/zapcore"
 )
 
 const (
@@ -23,9 +26,15 @@ type Application struct {
 
 	listenAddr        string
 	serverAPIEndpoint string
-	pubKey            string
-	secretKey         string
+	ecbSource         string
+	redisAddr         string
+	remoteAddr        string
 	tickerValue       int
+	envPrefix         string
+
+	logLevel zap.AtomicLevel
+	configM  sync.Mutex
+	started  map[string]string
 
 	rootCmd *cobra.Command
 }
@@ -41,17 +50,20 @@ func (app *Application) InitCommands() {
 		Use:   "currency",
 		Short: "currency API",
 		Long:  "currency info API",
-		Run: func(cmd *cobra.Command, args []string) {
-			app.Init()
-			app.Server.Run()
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return app.Serve()
 		},
 	}
 
 	app.rootCmd.PersistentFlags().StringVarP(&app.listenAddr, "service_address", "l", "localhost:8888", "service address")
-	app.rootCmd.PersistentFlags().StringVarP(&app.pubKey, "pub_k_bitcoinaverage", "p", "", "public key to bitcoinaverage")
-	app.rootCmd.PersistentFlags().StringVarP(&app.secretKey, "secret_k_bitcoinaverage", "s", "", "secret key to bitcoinaverage")
 	app.rootCmd.PersistentFlags().StringVarP(&app.serverAPIEndpoint, "api", "a", "", "API URL endpoint")
 	app.rootCmd.PersistentFlags().IntVarP(&app.tickerValue, "ticker_value", "t", 5, "time to wait")
+	app.rootCmd.PersistentFlags().StringVar(&app.ecbSource, "ecb_source", "", "ECB reference rates XML (url or file)")
+	app.rootCmd.PersistentFlags().StringVarP(&app.redisAddr, "redis_addr", "r", "", "Redis address")
+	app.rootCmd.PersistentFlags().StringVar(&app.remoteAddr, "remote", "", "currency server API URL (http://localhost:8888/api/) - use HTTP API instead of Redis")
+
+	app.rootCmd.SilenceUsage = true
+	app.AddCommands()
 }
 
 func (app *Application) InitConfig(configName, envPrefix string) {
@@ -67,17 +79,44 @@ func (app *Application) InitConfig(configName, envPrefix string) {
 	cfg.BindPFlag("server.apiPrefix", app.rootCmd.PersistentFlags().Lookup("api"))
 	cfg.SetDefault("ticker.value", 1)
 	cfg.BindPFlag("ticker.value", app.rootCmd.PersistentFlags().Lookup("ticker_value"))
-	cfg.SetDefault("pub.key", "")
-	cfg.BindPFlag("pub.key", app.rootCmd.PersistentFlags().Lookup("pub_k_bitcoinaverage"))
-	cfg.SetDefault("secret.key", "")
-	cfg.BindPFlag("secret.key", app.rootCmd.PersistentFlags().Lookup("secret_k_bitcoinaverage"))
+	cfg.SetDefault("pub.key_file", "")
+	cfg.SetDefault("secret.key_file", "")
+	cfg.SetDefault("redis.addr", "redis:6379")
+	cfg.BindPFlag("redis.addr", app.rootCmd.PersistentFlags().Lookup("redis_addr"))
+	cfg.SetDefault("remote.addr", "")
+	cfg.BindPFlag("remote.addr", app.rootCmd.PersistentFlags().Lookup("remote"))
+	cfg.SetDefault("indicators.windows", "5,20,50")
+	cfg.SetDefault("admin.token", "")
+	cfg.SetDefault("http.trusted_proxies", "")
+	cfg.SetDefault("leader.id", "")
+	cfg.SetDefault("leader.ttl", "15s")
+	cfg.SetDefault("update.min_interval", DefaultMinRefresh.String())
+	cfg.SetDefault("guard.max_deviation", DefaultGuardDeviation)
+	cfg.SetDefault("guard.confirmations", DefaultGuardConfirmations)
+	cfg.SetDefault("pairs", "")
+	cfg.SetDefault("log.level", "debug")
+	cfg.SetDefault("log.format", service.LogFormatConsole)
+	cfg.SetDefault("tracing.exporter", service.TracingExporterNone)
+	cfg.SetDefault("tracing.endpoint", "localhost:4318")
+	cfg.SetDefault("tracing.insecure", true)
+	cfg.SetDefault("tracing.sample", 1.0)
+	cfg.SetDefault("ecb.source", ECBDailyURL)
+	cfg.BindPFlag("ecb.source", app.rootCmd.PersistentFlags().Lookup("ecb_source"))
+	cfg.SetDefault("ecb.timeout", ECBTimeout.String())
+	cfg.SetDefault("history.retention", DefaultHistoryRetention)
 
 	cfg.SetConfigName(configName)
 	cfg.AddConfigPath("/etc/")
 	cfg.AddConfigPath("$HOME/")
 	cfg.AddConfigPath("./")
+	if err := cfg.ReadInConfig(); err != nil {
+		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
+			panic("Failed to read config file: " + err.Error())
+		}
+	}
 
 	app.cfg = cfg
+	app.envPrefix = envPrefix
 }
 
 func (app *Application) GetConfig() *viper.Viper {
@@ -86,13 +125,17 @@ func (app *Application) GetConfig() *viper.Viper {
 
 func (app *Application) ConfigureLog() {
 
-	config := zap.NewDevelopmentConfig()
-	config.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	app.logLevel = zap.NewAtomicLevel()
+	if err := app.logLevel.UnmarshalText([]byte(app.cfg.GetString("log.level"))); err != nil {
+		panic("Bad log.level: " + app.cfg.GetString("log.level"))
+	}
+	config := service.NewLoggerConfig(app.cfg.GetString("log.format"), app.logLevel)
 	logger, err := config.Build()
 	if err != nil {
 		panic("Failed to initialize logger")
 	}
 	Logger = logger.Sugar()
+	service.Logger = Logger
 }
 
 func (app *Application) Configure(params ...string) {
@@ -114,15 +157,86 @@ func (app *Application) Configure(params ...string) {
 func (app *Application) Init() {
 
 	app.listenAddr = app.cfg.GetString("server.addr")
+	pairs, err := ParsePairs(app.cfg.GetString("pairs"))
+	if err != nil {
+		Logger.Errorw("Bad pairs - use default", "err", err)
+		pairs = DefaultPairs()
+	}
+	currencies, err := ParseCurrencyOverrides(app.cfg)
+	if err != nil {
+		Logger.Errorw("Bad currencies - use bundled table", "err", err)
+	}
+	proxies, err := ParseTrustedProxies(app.cfg.GetString("http.trusted_proxies"))
+	if err != nil {
+		Logger.Errorw("Bad http.trusted_proxies - X-Forwarded-For is ignored", "err", err)
+	}
+	retention, err := ParseRetention(app.cfg.GetString("history.retention"))
+	if err != nil {
+		Logger.Errorw("Bad history.retention - use default", "err", err)
+		retention, _ = ParseRetention(DefaultHistoryRetention)
+	}
 	app.Server = NewServer(CurrencyServerConfig{
-		address:   app.cfg.GetString("server.addr"),
-		apiPrefix: app.cfg.GetString("server.apiPrefix"),
-		ticker:    app.cfg.GetInt64("ticker.value"),
+		address:    app.cfg.GetString("server.addr"),
+		apiPrefix:  app.cfg.GetString("server.apiPrefix"),
+		ticker:     app.cfg.GetInt64("ticker.value"),
+		ecbSource:  app.cfg.GetString("ecb.source"),
+		ecbTimeout: app.cfg.GetDuration("ecb.timeout"),
+		redisAddr:  app.cfg.GetString("redis.addr"),
+		windows:    ParseWindows(app.cfg.GetString("indicators.windows")),
+
+		adminToken:     app.cfg.GetString("admin.token"),
+		trustedProxies: proxies,
+		leaderID:       app.cfg.GetString("leader.id"),
+		leaderTTL:      app.cfg.GetDuration("leader.ttl"),
+		minRefresh:     app.cfg.GetDuration("update.min_interval"),
+		pairs:          pairs,
+		currencies:     currencies,
+
+		historyRetention:   retention,
+		guardDeviation:     app.cfg.GetFloat64("guard.max_deviation"),
+		guardConfirmations: app.cfg.GetInt("guard.confirmations"),
+
+		credentials: NewCredentials(app.envPrefix, app.cfg.GetString("pub.key_file"), app.cfg.GetString("secret.key_file")),
 	})
 }
 
+/*
+Serve
+запуск сервера, без ключей bitcoinaverage сервер не запускается
+*/
+func (app *Application) Serve() error {
+	app.Init()
+	if err := app.Server.CheckCredentials(); err != nil {
+		Logger.Errorw("Can't start server - set bitcoinaverage keys in env or secret files",
+			"env", []string{app.Server.Credentials.Public.Env, app.Server.Credentials.Secret.Env},
+			"files", []string{"pub.key_file", "secret.key_file"},
+			"err", err)
+		return err
+	}
+	shutdown, err := service.InitTracing(app.TracingConfig())
+	if err != nil {
+		Logger.Errorw("Can't init tracing", "err", err)
+		return err
+	}
+	defer shutdown(context.Background())
+
+	app.WatchConfig()
+	app.Server.Run()
+	return nil
+}
+
+func (app *Application) TracingConfig() service.TracingConfig {
+	return service.TracingConfig{
+		Service:  ServiceName,
+		Exporter: app.cfg.GetString("tracing.exporter"),
+		Endpoint: app.cfg.GetString("tracing.endpoint"),
+		Insecure: app.cfg.GetBool("tracing.insecure"),
+		Sample:   app.cfg.GetFloat64("tracing.sample"),
+	}
+}
+
 func (app *Application) Run() {
 	if err := app.rootCmd.Execute(); err != nil {
-		panic(err)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,284 @@
+package libcurrency
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SArtemJ/CurrencyGameExample/currency/money"
+	"github.com/SArtemJ/CurrencyGameExample/currency/service"
+	"github.com/go-redis/redis"
+)
+
+const (
+	AuditStream = "audit:rates"
+
+	SourceTicker   = "ticker"
+	SourceAPI      = "api"
+	SourceOverride = "override"
+	SourceCLI      = "cli"
+
+	ProviderBitcoinAverage = "bitcoinaverage"
+	ProviderECB            = "ecb"
+	ProviderOverride       = "override"
+)
+
+/*
+Actor
+кто изменил курс
+Source - ticker, api, override, cli
+IP - адрес клиента (с учетом доверенных прокси), Remote - адрес соединения
+*/
+type Actor struct {
+	Name   string
+	IP     string
+	Remote string
+	Source string
+}
+
+var TickerActor = Actor{Name: "ticker", Source: SourceTicker}
+
+/*
+TrustedProxies
+адреса прокси (IP или CIDR) которым доверяется заголовок X-Forwarded-For
+список меняется без перезапуска (http.trusted_proxies)
+*/
+type TrustedProxies struct {
+	m    sync.RWMutex
+	nets []*net.IPNet
+}
+
+func NewTrustedProxies(nets []*net.IPNet) *TrustedProxies {
+	p := &TrustedProxies{}
+	p.Set(nets)
+	return p
+}
+
+/*
+ParseTrustedProxies
+список адресов через запятую (10.0.0.1,192.168.0.0/16)
+*/
+func ParseTrustedProxies(value string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, v := range strings.Split(value, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("bad proxy address %q", v)
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("bad proxy network %q", v)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func (p *TrustedProxies) Set(nets []*net.IPNet) {
+	p.m.Lock()
+	defer p.m.Unlock()
+	p.nets = nets
+}
+
+func (p *TrustedProxies) Contains(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	p.m.RLock()
+	defer p.m.RUnlock()
+	for _, n := range p.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ClientIP
+адрес клиента - X-Forwarded-For учитывается только если соединение пришло от доверенного прокси,
+адреса в X-Forwarded-For проверяются справа налево до первого недоверенного
+*/
+func (p *TrustedProxies) ClientIP(r *http.Request) string {
+	ip := remoteIP(r)
+	if !p.Contains(ip) {
+		return ip
+	}
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+		if !p.Contains(hop) {
+			break
+		}
+	}
+	return ip
+}
+
+func remoteIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+/*
+RequestActor
+автор изменения по HTTP запросу
+имя - заголовок X-Actor только в запросах с токеном администратора (без X-Actor - admin),
+остальные запросы - anonymous
+IP - адрес клиента с учетом доверенных прокси, Remote - адрес соединения записывается всегда
+*/
+func (server *CurrencyServer) RequestActor(r *http.Request, source string) Actor {
+	name := "anonymous"
+	if server.isAdmin(r) {
+		name = "admin"
+		if v := r.Header.Get("X-Actor"); v != "" {
+			name = v
+		}
+	}
+	return Actor{Name: name, IP: server.Proxies.ClientIP(r), Remote: remoteIP(r), Source: source}
+}
+
+/*
+AuditEntry
+запись журнала изменений курсов
+*/
+type AuditEntry struct {
+	ID       string       `json:"id"`
+	Time     time.Time    `json:"time"`
+	Pair     string       `json:"pair"`
+	Old      money.Amount `json:"old"`
+	New      money.Amount `json:"new"`
+	Provider string       `json:"provider"`
+	Actor    string       `json:"actor"`
+	IP       string       `json:"ip,omitempty"`
+	Remote   string       `json:"remote,omitempty"`
+	Source   string       `json:"source"`
+}
+
+type ReturnAudit struct {
+	Entries []AuditEntry `json:"entries"`
+	Next    string       `json:"next,omitempty"`
+}
+
+/*
+AddAudit
+добавляет запись в журнал изменений (Redis stream audit:rates - только добавление)
+*/
+func (server *CurrencyServer) AddAudit(ctx context.Context, pair string, old, new money.Amount, actor Actor, provider string) {
+	err := server.rdb(ctx).XAdd(&redis.XAddArgs{
+		Stream: AuditStream,
+		ID:     "*",
+		Values: map[string]interface{}{
+			"pair":     pair,
+			"old":      old.String(),
+			"new":      new.String(),
+			"provider": provider,
+			"actor":    actor.Name,
+			"ip":       actor.IP,
+			"remote":   actor.Remote,
+			"source":   actor.Source,
+		},
+	}).Err()
+	if err != nil {
+		Logger.Debugw("Can't save audit entry to Redis", "pair", pair, "err", err)
+	}
+}
+
+/*
+GetAuditEntries
+записи журнала от новых к старым начиная с before (включительно, пусто - с последней)
+возвращает count записей и id для следующей страницы
+*/
+func (server *CurrencyServer) GetAuditEntries(ctx context.Context, before string, count int64) ([]AuditEntry, string, error) {
+	if before == "" {
+		before = "+"
+	}
+	messages, err := server.rdb(ctx).XRevRangeN(AuditStream, before, "-", count+1).Result()
+	if err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+	if int64(len(messages)) > count {
+		next = messages[count].ID
+		messages = messages[:count]
+	}
+
+	entries := make([]AuditEntry, 0, len(messages))
+	for _, m := range messages {
+		entries = append(entries, auditEntryFromMessage(m))
+	}
+	return entries, next, nil
+}
+
+func auditEntryFromMessage(m redis.XMessage) AuditEntry {
+	str := func(key string) string {
+		v, _ := m.Values[key].(string)
+		return v
+	}
+	e := AuditEntry{
+		ID:       m.ID,
+		Pair:     str("pair"),
+		Provider: str("provider"),
+		Actor:    str("actor"),
+		IP:       str("ip"),
+		Remote:   str("remote"),
+		Source:   str("source"),
+	}
+	e.Old, _ = money.Parse(str("old"))
+	e.New, _ = money.Parse(str("new"))
+	// id записи stream - <unix время в мс>-<номер>
+	if ms, err := strconv.ParseInt(strings.Split(m.ID, "-")[0], 10, 64); err == nil {
+		e.Time = time.Unix(0, ms*int64(time.Millisecond)).UTC()
+	}
+	return e
+}
+
+/*
+GetAudit
+GET /audit?count=50&before=<id>
+*/
+func (server *CurrencyServer) GetAudit(w http.ResponseWriter, r *http.Request) {
+	logger := service.RequestLogger(r)
+	count := int64(50)
+	if v := r.FormValue("count"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 || n > 500 {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, "Bad request incorrect count (1-500)")
+			return
+		}
+		count = n
+	}
+
+	entries, next, err := server.GetAuditEntries(r.Context(), r.FormValue("before"), count)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, "Can't get audit from Redis")
+		logger.Debugw("Can't get audit from Redis", "err", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	json.NewEncoder(w).Encode(ReturnAudit{Entries: entries, Next: next})
+}
@@ -0,0 +1,36 @@
+package libcurrency
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestActor(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.1, 192.168.0.0/16")
+	require.NoError(t, err)
+	server := &CurrencyServer{AdminToken: "test-token", Proxies: NewTrustedProxies(proxies)}
+
+	req, _ := http.NewRequest("PATCH", "/api/update/BTCUSD", nil)
+	req.RemoteAddr = "1.2.3.4:5555"
+	req.Header.Set("X-Actor", "qa")
+	req.Header.Set("X-Forwarded-For", "5.6.7.8")
+	// без токена администратора X-Actor и X-Forwarded-For от недоверенного адреса не учитываются
+	assert.Equal(t, Actor{Name: "anonymous", IP: "1.2.3.4", Remote: "1.2.3.4", Source: SourceAPI}, server.RequestActor(req, SourceAPI))
+
+	req.Header.Set("Authorization", "Bearer test-token")
+	req.RemoteAddr = "10.0.0.1:5555"
+	req.Header.Set("X-Forwarded-For", "9.9.9.9, 5.6.7.8, 192.168.1.10")
+	assert.Equal(t, Actor{Name: "qa", IP: "5.6.7.8", Remote: "10.0.0.1", Source: SourceAPI}, server.RequestActor(req, SourceAPI))
+
+	req.Header.Del("X-Actor")
+	req.Header.Set("X-Forwarded-For", "garbage")
+	assert.Equal(t, Actor{Name: "admin", IP: "10.0.0.1", Remote: "10.0.0.1", Source: SourceAPI}, server.RequestActor(req, SourceAPI))
+
+	_, err = ParseTrustedProxies("10.0.0.0/33")
+	assert.Error(t, err)
+	_, err = ParseTrustedProxies("proxy")
+	assert.Error(t, err)
+}
@@ -0,0 +1,102 @@
+package libcurrency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultMinRefresh = time.Second * 5
+	// DefaultUpdateTimeout - сколько может выполняться общее обновление пары
+	DefaultUpdateTimeout = time.Second * 30
+)
+
+type coalescedCall struct {
+	done chan struct{}
+	ok   bool
+}
+
+/*
+Coalescer
+объединяет одновременные обновления одной пары
+пока обновление пары выполняется, остальные вызовы ждут его и получают тот же результат
+после успешного обновления в течение MinInterval повторные вызовы не обращаются к источнику
+общее обновление не зависит от отмены контекста вызвавшего его запроса и ограничено Timeout
+*/
+type Coalescer struct {
+	MinInterval time.Duration
+	Timeout     time.Duration
+
+	m         sync.Mutex
+	calls     map[string]*coalescedCall
+	refreshed map[string]time.Time
+}
+
+func NewCoalescer(minInterval time.Duration) *Coalescer {
+	return &Coalescer{
+		MinInterval: minInterval,
+		Timeout:     DefaultUpdateTimeout,
+		calls:       map[string]*coalescedCall{},
+		refreshed:   map[string]time.Time{},
+	}
+}
+
+/*
+Do
+выполняет fn для key, если для key нет выполняющегося вызова и не прошло MinInterval с последнего успешного
+fn выполняется в отдельной горутине с контекстом без отмены ctx (значения ctx сохраняются) и таймаутом Timeout,
+вызов ждет результат пока не отменен его ctx - отмена одного запроса не прерывает обновление для остальных
+паника в fn - результат false для всех ожидающих
+fresh - fn не вызывалась, значение обновлялось недавно
+*/
+func (c *Coalescer) Do(ctx context.Context, key string, fn func(ctx context.Context) bool) (ok bool, fresh bool) {
+	c.m.Lock()
+	if last, found := c.refreshed[key]; found && time.Since(last) < c.MinInterval {
+		c.m.Unlock()
+		return true, true
+	}
+	call, found := c.calls[key]
+	if !found {
+		call = &coalescedCall{done: make(chan struct{})}
+		c.calls[key] = call
+		go c.run(ctx, key, call, fn)
+	}
+	c.m.Unlock()
+
+	select {
+	case <-call.done:
+		return call.ok, false
+	case <-ctx.Done():
+		return false, false
+	}
+}
+
+func (c *Coalescer) run(ctx context.Context, key string, call *coalescedCall, fn func(ctx context.Context) bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			Logger.Errorw("Currency update panic", "key", key, "panic", r)
+			call.ok = false
+		}
+		c.m.Lock()
+		delete(c.calls, key)
+		if call.ok {
+			c.refreshed[key] = time.Now()
+		}
+		c.m.Unlock()
+		close(call.done)
+	}()
+
+	c.m.Lock()
+	timeout := c.Timeout
+	c.m.Unlock()
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+	call.ok = fn(ctx)
+}
+
+func (c *Coalescer) SetMinInterval(d time.Duration) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.MinInterval = d
+}
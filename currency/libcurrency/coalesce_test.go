@@ -0,0 +1,146 @@
+package libcurrency
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCoalescerSharesInFlightCall(t *testing.T) {
+	c := NewCoalescer(0)
+	var calls int32
+	release := make(chan struct{})
+	fn := func(ctx context.Context) bool {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return true
+	}
+
+	var wg sync.WaitGroup
+	results := make([]bool, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = c.Do(context.Background(), "BTCUSD", fn)
+		}(i)
+	}
+	time.Sleep(time.Millisecond * 50)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	for _, ok := range results {
+		assert.True(t, ok)
+	}
+}
+
+func TestCoalescerMinInterval(t *testing.T) {
+	c := NewCoalescer(time.Millisecond * 100)
+	calls := 0
+	fn := func(ctx context.Context) bool {
+		calls++
+		return true
+	}
+
+	ok, fresh := c.Do(context.Background(), "BTCUSD", fn)
+	assert.True(t, ok)
+	assert.False(t, fresh)
+	ok, fresh = c.Do(context.Background(), "BTCUSD", fn)
+	assert.True(t, ok)
+	assert.True(t, fresh)
+	assert.Equal(t, 1, calls)
+
+	// другие пары не ограничены
+	c.Do(context.Background(), "BTCEUR", fn)
+	assert.Equal(t, 2, calls)
+
+	time.Sleep(time.Millisecond * 150)
+	c.Do(context.Background(), "BTCUSD", fn)
+	assert.Equal(t, 3, calls)
+}
+
+func TestCoalescerFailureNotCached(t *testing.T) {
+	c := NewCoalescer(time.Minute)
+	calls := 0
+	fn := func(ctx context.Context) bool {
+		calls++
+		return false
+	}
+	ok, _ := c.Do(context.Background(), "BTCUSD", fn)
+	assert.False(t, ok)
+	ok, _ = c.Do(context.Background(), "BTCUSD", fn)
+	assert.False(t, ok)
+	assert.Equal(t, 2, calls)
+}
+
+func TestCoalescerDetachedFromCaller(t *testing.T) {
+	c := NewCoalescer(0)
+	release := make(chan struct{})
+	var fnErr error
+	fn := func(ctx context.Context) bool {
+		<-release
+		fnErr = ctx.Err()
+		return true
+	}
+
+	// первый вызов отменен - общее обновление продолжается для остальных
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan bool)
+	go func() {
+		ok, _ := c.Do(ctx, "BTCUSD", fn)
+		first <- ok
+	}()
+	time.Sleep(time.Millisecond * 20)
+	second := make(chan bool)
+	go func() {
+		ok, _ := c.Do(context.Background(), "BTCUSD", fn)
+		second <- ok
+	}()
+	time.Sleep(time.Millisecond * 20)
+	cancel()
+	assert.False(t, <-first)
+	close(release)
+	assert.True(t, <-second)
+	assert.NoError(t, fnErr)
+
+	// общее обновление ограничено Timeout
+	c.Timeout = time.Millisecond * 20
+	ok, _ := c.Do(context.Background(), "BTCEUR", func(ctx context.Context) bool {
+		<-ctx.Done()
+		return false
+	})
+	assert.False(t, ok)
+}
+
+func TestCoalescerPanic(t *testing.T) {
+	c := NewCoalescer(time.Minute)
+	release := make(chan struct{})
+	fn := func(ctx context.Context) bool {
+		<-release
+		panic("bitcoinaverage")
+	}
+
+	var wg sync.WaitGroup
+	results := make([]bool, 3)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = c.Do(context.Background(), "BTCUSD", fn)
+		}(i)
+	}
+	time.Sleep(time.Millisecond * 20)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, []bool{false, false, false}, results)
+
+	// следующий вызов выполняет fn заново
+	ok, fresh := c.Do(context.Background(), "BTCUSD", func(ctx context.Context) bool { return true })
+	assert.True(t, ok)
+	assert.False(t, fresh)
+}
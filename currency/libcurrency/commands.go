@@ -0,0 +1,343 @@
+package libcurrency
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SArtemJ/CurrencyGameExample/currency/currencyclient"
+	"github.com/SArtemJ/CurrencyGameExample/currency/money"
+	"github.com/spf13/cobra"
+)
+
+/*
+RateBackend
+источник данных для команд cli - Redis напрямую или HTTP API запущенного сервера
+*/
+type RateBackend interface {
+	Get(pair string) (money.Amount, error)
+	List() (map[string]money.Amount, error)
+	Update(pair string) error
+	History(pair string, from, to time.Time) ([]RatePoint, error)
+	ExportHistory(w io.Writer, pair, format string, from, to time.Time) error
+	ImportHistory(r io.Reader, pair string) (*ImportSummary, error)
+}
+
+func (app *Application) AddCommands() {
+	app.rootCmd.AddCommand(&cobra.Command{
+		Use:   "serve",
+		Short: "start currency server",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return app.Serve()
+		},
+	})
+
+	app.rootCmd.AddCommand(&cobra.Command{
+		Use:   "get PAIR",
+		Short: "print current rate of pair (BTCUSD)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			backend, err := app.Backend()
+			if err != nil {
+				return err
+			}
+			value, err := backend.Get(strings.ToUpper(args[0]))
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), value.String())
+			return nil
+		},
+	})
+
+	app.rootCmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "print current rates of all pairs",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			backend, err := app.Backend()
+			if err != nil {
+				return err
+			}
+			rates, err := backend.List()
+			if err != nil {
+				return err
+			}
+			pairs := make([]string, 0, len(rates))
+			for k := range rates {
+				pairs = append(pairs, k)
+			}
+			sort.Strings(pairs)
+			for _, k := range pairs {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s\t%s\n", k, rates[k])
+			}
+			return nil
+		},
+	})
+
+	app.rootCmd.AddCommand(&cobra.Command{
+		Use:   "update [PAIR]",
+		Short: "update rate of pair or all pairs from upstream",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			backend, err := app.Backend()
+			if err != nil {
+				return err
+			}
+			pair := ""
+			if len(args) == 1 {
+				pair = strings.ToUpper(args[0])
+			}
+			if err := backend.Update(pair); err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), "updated")
+			return nil
+		},
+	})
+
+	var since string
+	historyCmd := &cobra.Command{
+		Use:   "history PAIR",
+		Short: "print rate history of pair",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			from, _, err := ParsePeriod(since, "", "")
+			if err != nil {
+				return err
+			}
+			backend, err := app.Backend()
+			if err != nil {
+				return err
+			}
+			points, err := backend.History(strings.ToUpper(args[0]), from, time.Time{})
+			if err != nil {
+				return err
+			}
+			for _, p := range points {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s\t%s\n", p.Time.Format(time.RFC3339), p.Value)
+			}
+			return nil
+		},
+	}
+	historyCmd.Flags().StringVar(&since, "since", "24h", "period (90m, 24h, 7d)")
+	app.rootCmd.AddCommand(historyCmd)
+
+	var exportFormat, exportSince, exportFrom, exportTo string
+	exportCmd := &cobra.Command{
+		Use:   "export [PAIR]",
+		Short: "export current rates of all pairs as JSON or rate history of pair as csv/jsonl",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 1 {
+				from, to, err := ParsePeriod(exportSince, exportFrom, exportTo)
+				if err != nil {
+					return err
+				}
+				if _, err := NewHistoryEncoder(ioutil.Discard, exportFormat); err != nil {
+					return err
+				}
+				backend, err := app.Backend()
+				if err != nil {
+					return err
+				}
+				return backend.ExportHistory(cmd.OutOrStdout(), strings.ToUpper(args[0]), strings.ToLower(exportFormat), from, to)
+			}
+
+			backend, err := app.Backend()
+			if err != nil {
+				return err
+			}
+			rates, err := backend.List()
+			if err != nil {
+				return err
+			}
+			enc := json.NewEncoder(cmd.OutOrStdout())
+			enc.SetIndent("", "  ")
+			return enc.Encode(rates)
+		},
+	}
+	exportCmd.Flags().StringVar(&exportFormat, "format", ExportFormatCSV, "history format (csv, jsonl)")
+	exportCmd.Flags().StringVar(&exportSince, "since", "", "period (90m, 24h, 7d)")
+	exportCmd.Flags().StringVar(&exportFrom, "from", "", "start of period (RFC3339 or unix time)")
+	exportCmd.Flags().StringVar(&exportTo, "to", "", "end of period (RFC3339 or unix time)")
+	app.rootCmd.AddCommand(exportCmd)
+
+	app.rootCmd.AddCommand(&cobra.Command{
+		Use:   "import PAIR [FILE]",
+		Short: "load rate history of pair from CSV file (time,pair,value or time,value), without FILE or with - from stdin",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			in := cmd.InOrStdin()
+			if len(args) == 2 && args[1] != "-" {
+				f, err := os.Open(args[1])
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				in = f
+			}
+			backend, err := app.Backend()
+			if err != nil {
+				return err
+			}
+			summary, err := backend.ImportHistory(in, strings.ToUpper(args[0]))
+			if summary != nil {
+				fmt.Fprintln(cmd.OutOrStdout(), summary.String())
+				for _, e := range summary.Errors {
+					fmt.Fprintln(cmd.OutOrStdout(), "\t"+e)
+				}
+			}
+			return err
+		},
+	})
+}
+
+/*
+Backend
+если задан remote.addr - команды работают через HTTP API сервера, иначе напрямую с Redis
+*/
+func (app *Application) Backend() (RateBackend, error) {
+	if remote := app.cfg.GetString("remote.addr"); remote != "" {
+		backend := NewHTTPBackend(remote)
+		backend.Client.AdminToken = app.cfg.GetString("admin.token")
+		return backend, nil
+	}
+	app.Init()
+	if !app.Server.RedisConnect() {
+		return nil, fmt.Errorf("no connection to Redis %s", app.Server.RedisAddr)
+	}
+	return &RedisBackend{Server: app.Server}, nil
+}
+
+/*
+CLIActor
+автор изменений сделанных командами cli - пользователь ОС
+*/
+func CLIActor() Actor {
+	name := os.Getenv("USER")
+	if name == "" {
+		name = "cli"
+	}
+	return Actor{Name: name, Source: SourceCLI}
+}
+
+type RedisBackend struct {
+	Server *CurrencyServer
+}
+
+func (b *RedisBackend) Get(pair string) (money.Amount, error) {
+	if !b.Server.HasPair(pair) {
+		return money.Zero, fmt.Errorf("unknown pair %s", pair)
+	}
+	return b.Server.GetRValue(context.Background(), pair), nil
+}
+
+func (b *RedisBackend) List() (map[string]money.Amount, error) {
+	rates := map[string]money.Amount{}
+	for _, k := range b.Server.Pairs() {
+		rates[k] = b.Server.GetRValue(context.Background(), k)
+	}
+	return rates, nil
+}
+
+func (b *RedisBackend) Update(pair string) error {
+	if pair == "" {
+		b.Server.DoUpdateImmediately(context.Background(), CLIActor())
+		return nil
+	}
+	if !b.Server.HasPair(pair) {
+		return fmt.Errorf("unknown pair %s", pair)
+	}
+	if !b.Server.CurrencyUpdate(context.Background(), pair, CLIActor()) {
+		return fmt.Errorf("can't update %s from upstream", pair)
+	}
+	return nil
+}
+
+func (b *RedisBackend) History(pair string, from, to time.Time) ([]RatePoint, error) {
+	if !b.Server.HasPair(pair) {
+		return nil, fmt.Errorf("unknown pair %s", pair)
+	}
+	return b.Server.GetHistory(context.Background(), pair, from, to)
+}
+
+func (b *RedisBackend) ExportHistory(w io.Writer, pair, format string, from, to time.Time) error {
+	if !b.Server.HasPair(pair) {
+		return fmt.Errorf("unknown pair %s", pair)
+	}
+	_, err := b.Server.ExportHistory(context.Background(), w, pair, format, from, to)
+	return err
+}
+
+func (b *RedisBackend) ImportHistory(r io.Reader, pair string) (*ImportSummary, error) {
+	if !b.Server.HasPair(pair) {
+		return nil, fmt.Errorf("unknown pair %s", pair)
+	}
+	return b.Server.ImportHistory(context.Background(), r, pair)
+}
+
+/*
+HTTPBackend
+работает через HTTP API запущенного сервера (см. currencyclient)
+*/
+type HTTPBackend struct {
+	Client *currencyclient.Client
+}
+
+func NewHTTPBackend(url string) *HTTPBackend {
+	return &HTTPBackend{Client: currencyclient.NewClient(url, time.Second*30)}
+}
+
+func (b *HTTPBackend) Get(pair string) (money.Amount, error) {
+	return b.Client.Rate(context.Background(), pair)
+}
+
+func (b *HTTPBackend) List() (map[string]money.Amount, error) {
+	return b.Client.Rates(context.Background())
+}
+
+func (b *HTTPBackend) Update(pair string) error {
+	if pair == "" {
+		return b.Client.UpdateAll(context.Background())
+	}
+	return b.Client.Update(context.Background(), pair)
+}
+
+func (b *HTTPBackend) History(pair string, from, to time.Time) ([]RatePoint, error) {
+	points, err := b.Client.History(context.Background(), pair, from, to)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]RatePoint, len(points))
+	for i, p := range points {
+		result[i] = RatePoint{Time: p.Time, Value: p.Value}
+	}
+	return result, nil
+}
+
+func (b *HTTPBackend) ExportHistory(w io.Writer, pair, format string, from, to time.Time) error {
+	body, err := b.Client.ExportHistory(context.Background(), pair, format, from, to)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	_, err = io.Copy(w, body)
+	return err
+}
+
+func (b *HTTPBackend) ImportHistory(r io.Reader, pair string) (*ImportSummary, error) {
+	summary, err := b.Client.ImportHistory(context.Background(), pair, r)
+	if err != nil {
+		return nil, err
+	}
+	result := ImportSummary(*summary)
+	return &result, nil
+}
@@ -0,0 +1,142 @@
+package libcurrency
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SArtemJ/CurrencyGameExample/currency/money"
+	"github.com/go-redis/redis"
+)
+
+const (
+	MetaKeyPrefix = "meta:"
+)
+
+/*
+RateMeta
+значение курса вместе с номером версии пары и временем последнего обновления
+Pinned - курс зафиксирован (ключ pin:<pair> существует)
+*/
+type RateMeta struct {
+	Value   money.Amount
+	Version int64
+	Updated time.Time
+	Pinned  bool
+}
+
+func metaKey(pair string) string {
+	return MetaKeyPrefix + pair
+}
+
+/*
+GetRMeta
+читает значения и метаданные пар одним pipeline запросом
+*/
+func (server *CurrencyServer) GetRMeta(ctx context.Context, keys ...string) (map[string]RateMeta, error) {
+	values := make([]*redis.StringCmd, len(keys))
+	metas := make([]*redis.StringStringMapCmd, len(keys))
+	pins := make([]*redis.IntCmd, len(keys))
+	_, err := server.rdb(ctx).TxPipelined(func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			values[i] = pipe.Get(key)
+			metas[i] = pipe.HGetAll(metaKey(key))
+			pins[i] = pipe.Exists(pinKey(key))
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	result := make(map[string]RateMeta, len(keys))
+	for i, key := range keys {
+		var m RateMeta
+		if str, err := values[i].Result(); err == nil {
+			m.Value, _ = money.Parse(str)
+		}
+		meta, _ := metas[i].Result()
+		m.Version, _ = strconv.ParseInt(meta["version"], 10, 64)
+		if sec, err := strconv.ParseInt(meta["updated"], 10, 64); err == nil {
+			m.Updated = time.Unix(sec, 0).UTC()
+		}
+		m.Pinned = pins[i].Val() == 1
+		result[key] = m
+	}
+	return result, nil
+}
+
+/*
+RatesETag
+ETag по значениям, версиям и фиксации пар - не зависит от порядка пар
+окончание фиксации по ttl меняет ETag сразу, до того как ReleasePins поменяет версию
+*/
+func RatesETag(metas map[string]RateMeta) string {
+	keys := make([]string, 0, len(metas))
+	for k := range metas {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha1.New()
+	for _, k := range keys {
+		h.Write([]byte(k + "=" + metas[k].Value.String() + "@" + strconv.FormatInt(metas[k].Version, 10)))
+		if metas[k].Pinned {
+			h.Write([]byte("!"))
+		}
+		h.Write([]byte(";"))
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil)) + `"`
+}
+
+/*
+RatesLastModified
+время самого позднего обновления среди пар
+*/
+func RatesLastModified(metas map[string]RateMeta) time.Time {
+	var last time.Time
+	for _, m := range metas {
+		if m.Updated.After(last) {
+			last = m.Updated
+		}
+	}
+	return last
+}
+
+/*
+CheckNotModified
+выставляет ETag и Last-Modified, если клиент уже имеет актуальные данные
+(If-None-Match или If-Modified-Since) - отвечает 304 и возвращает true
+If-None-Match имеет приоритет над If-Modified-Since
+*/
+func CheckNotModified(w http.ResponseWriter, r *http.Request, etag string, lastModified time.Time) bool {
+	w.Header().Set("ETag", etag)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, v := range strings.Split(inm, ",") {
+			v = strings.TrimPrefix(strings.TrimSpace(v), "W/")
+			if v == etag || v == "*" {
+				w.WriteHeader(http.StatusNotModified)
+				return true
+			}
+		}
+		return false
+	}
+
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !lastModified.IsZero() {
+		t, err := http.ParseTime(ims)
+		if err == nil && !lastModified.Truncate(time.Second).After(t) {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
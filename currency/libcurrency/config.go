@@ -0,0 +1,97 @@
+package libcurrency
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/SArtemJ/CurrencyGameExample/currency/service"
+)
+
+/*
+RestartKeys
+параметры которые применяются только после перезапуска
+остальные (ticker.value, log.level, update.min_interval, guard, history.retention, http.trusted_proxies, pairs, currencies) применяются сразу после изменения файла конфигурации
+*/
+var RestartKeys = []string{
+	"server.addr",
+	"server.apiPrefix",
+	"redis.addr",
+	"ecb.source",
+	"ecb.timeout",
+	"indicators.windows",
+	"admin.token",
+	"log.format",
+	"tracing.exporter",
+	"tracing.endpoint",
+	"tracing.insecure",
+	"tracing.sample",
+	"leader.id",
+	"leader.ttl",
+	"pub.key_file",
+	"secret.key_file",
+}
+
+/*
+WatchConfig
+следит за файлом конфигурации и применяет изменения без перезапуска
+*/
+func (app *Application) WatchConfig() {
+	app.started = service.RestartValues(app.cfg, RestartKeys)
+	app.ApplyConfig()
+	service.WatchConfig(app.cfg, app.ApplyConfig)
+}
+
+/*
+ApplyConfig
+применяет параметры которые можно менять на работающем сервере
+об измененных параметрах которые требуют перезапуска пишет в лог
+*/
+func (app *Application) ApplyConfig() {
+	app.configM.Lock()
+	defer app.configM.Unlock()
+	cfg := app.cfg
+	server := app.Server
+
+	if err := app.logLevel.UnmarshalText([]byte(cfg.GetString("log.level"))); err != nil {
+		Logger.Errorw("Bad log.level - not changed", "value", cfg.GetString("log.level"))
+	}
+	if ticker := cfg.GetInt64("ticker.value"); ticker > 0 {
+		server.SetTickerPeriod(time.Minute * time.Duration(ticker))
+	}
+	server.Updates.SetMinInterval(cfg.GetDuration("update.min_interval"))
+	server.Guard.Set(cfg.GetFloat64("guard.max_deviation"), cfg.GetInt("guard.confirmations"))
+	if retention, err := ParseRetention(cfg.GetString("history.retention")); err != nil {
+		Logger.Errorw("Bad history.retention - not changed", "value", cfg.GetString("history.retention"))
+	} else {
+		server.SetHistoryRetention(retention)
+	}
+	if proxies, err := ParseTrustedProxies(cfg.GetString("http.trusted_proxies")); err != nil {
+		Logger.Errorw("Bad http.trusted_proxies - not changed", "err", err)
+	} else {
+		server.Proxies.Set(proxies)
+	}
+	if currencies, err := ParseCurrencyOverrides(cfg); err != nil {
+		Logger.Errorw("Bad currencies - not changed", "err", err)
+	} else {
+		server.Currencies.Set(currencies)
+	}
+	if pairs, err := ParsePairs(cfg.GetString("pairs")); err != nil {
+		Logger.Errorw("Bad pairs - not changed", "err", err)
+	} else if strings.Join(pairs, ",") != strings.Join(server.Pairs(), ",") {
+		server.SetPairs(pairs)
+	}
+
+	pending := service.PendingRestart(cfg, RestartKeys, app.started)
+	server.Config.Set(cfg.ConfigFileUsed(), service.ConfigSettings(cfg), pending)
+}
+
+/*
+GetConfig
+GET /admin/config - действующие параметры
+*/
+func (server *CurrencyServer) GetConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	json.NewEncoder(w).Encode(server.Config.Get())
+}
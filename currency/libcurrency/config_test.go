@@ -0,0 +1,23 @@
+package libcurrency
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePairs(t *testing.T) {
+	pairs, err := ParsePairs("")
+	require.NoError(t, err)
+	assert.Equal(t, len(DefaultPairs()), len(pairs))
+
+	pairs, err = ParsePairs(" ethusd, BTCUSD,EURUSD,BTCUSD")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"BTCUSD", "ETHUSD", "EURUSD"}, pairs)
+
+	_, err = ParsePairs("ETHBTC")
+	assert.Error(t, err)
+	_, err = ParsePairs("XXXYYY")
+	assert.Error(t, err)
+}
@@ -0,0 +1,148 @@
+package libcurrency
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/SArtemJ/CurrencyGameExample/currency/money"
+	"github.com/SArtemJ/CurrencyGameExample/currency/service"
+)
+
+type rateEdge struct {
+	to   string
+	rate money.Amount
+	pair string
+}
+
+/*
+FindRate
+ищет курс from -> to по известным курсам пар
+используются прямые и обратные курсы пар, путь с наименьшим числом пересчетов
+(ETH -> RUB: ETHRUB; ETH -> BTC: ETHUSD, BTCUSD)
+возвращает курс и список пар через которые он получен
+*/
+func FindRate(rates map[string]money.Amount, from, to string) (money.Amount, []string, bool) {
+	if from == to {
+		return money.New(1, 0), nil, true
+	}
+
+	pairs := make([]string, 0, len(rates))
+	for pair := range rates {
+		pairs = append(pairs, pair)
+	}
+	sort.Strings(pairs)
+
+	graph := map[string][]rateEdge{}
+	for _, pair := range pairs {
+		rate := rates[pair]
+		base, quote := SplitPair(pair)
+		if base == "" || rate.Sign() <= 0 {
+			continue
+		}
+		inverse, err := money.New(1, 0).Div(rate)
+		if err != nil {
+			continue
+		}
+		graph[base] = append(graph[base], rateEdge{to: quote, rate: rate, pair: pair})
+		graph[quote] = append(graph[quote], rateEdge{to: base, rate: inverse, pair: pair})
+	}
+
+	type step struct {
+		rate  money.Amount
+		pairs []string
+	}
+	visited := map[string]step{from: {rate: money.New(1, 0)}}
+	queue := []string{from}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, e := range graph[current] {
+			if _, ok := visited[e.to]; ok {
+				continue
+			}
+			prev := visited[current]
+			next := step{
+				rate:  prev.rate.Mul(e.rate),
+				pairs: append(append([]string{}, prev.pairs...), e.pair),
+			}
+			if e.to == to {
+				return next.rate, next.pairs, true
+			}
+			visited[e.to] = next
+			queue = append(queue, e.to)
+		}
+	}
+	return money.Zero, nil, false
+}
+
+/*
+ReturnConvert
+результат пересчета суммы из одной валюты в другую
+*/
+type ReturnConvert struct {
+	From    string       `json:"from"`
+	To      string       `json:"to"`
+	Amount  money.Amount `json:"amount"`
+	Rate    money.Amount `json:"rate"`
+	Result  money.Amount `json:"result"`
+	Path    []string     `json:"path"`
+	Version int64        `json:"version"`
+}
+
+/*
+Convert
+пересчитывает сумму amount из валюты from в валюту to по текущим курсам (одно чтение из Redis)
+*/
+func (server *CurrencyServer) Convert(ctx context.Context, amount money.Amount, from, to string) (ReturnConvert, error) {
+	result := ReturnConvert{From: from, To: to, Amount: amount}
+	if !IsKnownAsset(from) || !IsKnownAsset(to) {
+		return result, fmt.Errorf("unknown currency %s or %s", from, to)
+	}
+
+	snapshot, err := server.GetRSnapshot(ctx, server.Pairs())
+	if err != nil {
+		return result, err
+	}
+
+	rate, path, ok := FindRate(snapshot.Rates, from, to)
+	if !ok {
+		return result, fmt.Errorf("no rates to convert %s to %s", from, to)
+	}
+	result.Rate = rate.RoundPlaces(16)
+	result.Result = amount.Mul(rate).Round(to)
+	result.Path = path
+	result.Version = snapshot.Version
+	return result, nil
+}
+
+/*
+ConvertCurrency
+GET /convert?from=ETH&to=RUB&amount=1.5
+*/
+func (server *CurrencyServer) ConvertCurrency(w http.ResponseWriter, r *http.Request) {
+	logger := service.RequestLogger(r)
+	amount := money.New(1, 0)
+	if v := r.FormValue("amount"); v != "" {
+		var err error
+		if amount, err = money.Parse(v); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, "Bad request incorrect amount")
+			return
+		}
+	}
+
+	result, err := server.Convert(r.Context(), amount, strings.ToUpper(r.FormValue("from")), strings.ToUpper(r.FormValue("to")))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "Bad request - "+err.Error())
+		logger.Debugw("Can't convert", "err", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,48 @@
+package libcurrency
+
+import (
+	"testing"
+
+	"github.com/SArtemJ/CurrencyGameExample/currency/money"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitPair(t *testing.T) {
+	base, quote := SplitPair("USDTRUB")
+	assert.Equal(t, "USDT", base)
+	assert.Equal(t, "RUB", quote)
+
+	base, quote = SplitPair("USDRUB")
+	assert.Equal(t, "USD", base)
+	assert.Equal(t, "RUB", quote)
+
+	base, _ = SplitPair("XXXYYY")
+	assert.Equal(t, "", base)
+}
+
+func TestFindRate(t *testing.T) {
+	rates := map[string]money.Amount{
+		"BTCUSD":  money.MustParse("6500"),
+		"ETHUSD":  money.MustParse("470"),
+		"ETHRUB":  money.MustParse("29610"),
+		"USDTUSD": money.MustParse("1"),
+		"LTCUSD":  money.Zero,
+	}
+
+	rate, path, ok := FindRate(rates, "ETH", "RUB")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"ETHRUB"}, path)
+	assert.Equal(t, "29610", rate.String())
+
+	rate, path, ok = FindRate(rates, "ETH", "BTC")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"ETHUSD", "BTCUSD"}, path)
+	assert.Equal(t, "0.07230769", rate.RoundPlaces(8).String())
+
+	rate, _, ok = FindRate(rates, "USD", "USDT")
+	assert.True(t, ok)
+	assert.Equal(t, "1", rate.String())
+
+	_, _, ok = FindRate(rates, "LTC", "USD")
+	assert.False(t, ok)
+}
@@ -0,0 +1,210 @@
+package libcurrency
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/SArtemJ/CurrencyGameExample/currency/money"
+	"github.com/SArtemJ/CurrencyGameExample/currency/service"
+	"github.com/spf13/viper"
+)
+
+/*
+CurrencyInfo
+сведения о валюте для клиентов - название, символ, количество знаков после запятой
+Numeric - числовой код ISO 4217 (у криптовалют нет)
+*/
+type CurrencyInfo struct {
+	Code       string `json:"code"`
+	Numeric    string `json:"numeric,omitempty"`
+	Name       string `json:"name"`
+	Symbol     string `json:"symbol"`
+	MinorUnits int32  `json:"minor_units"`
+	Crypto     bool   `json:"crypto"`
+}
+
+/*
+CurrencyTable
+встроенная таблица валют (ISO 4217 и криптовалюты)
+количество знаков криптовалют совпадает с правилами округления money.MinorUnits
+*/
+var CurrencyTable = map[string]CurrencyInfo{
+	"USD": {Code: "USD", Numeric: "840", Name: "US Dollar", Symbol: "$", MinorUnits: 2},
+	"EUR": {Code: "EUR", Numeric: "978", Name: "Euro", Symbol: "€", MinorUnits: 2},
+	"GBP": {Code: "GBP", Numeric: "826", Name: "Pound Sterling", Symbol: "£", MinorUnits: 2},
+	"RUB": {Code: "RUB", Numeric: "643", Name: "Russian Ruble", Symbol: "₽", MinorUnits: 2},
+	"JPY": {Code: "JPY", Numeric: "392", Name: "Yen", Symbol: "¥", MinorUnits: 0},
+	"CNY": {Code: "CNY", Numeric: "156", Name: "Yuan Renminbi", Symbol: "¥", MinorUnits: 2},
+	"CHF": {Code: "CHF", Numeric: "756", Name: "Swiss Franc", Symbol: "CHF", MinorUnits: 2},
+	"CAD": {Code: "CAD", Numeric: "124", Name: "Canadian Dollar", Symbol: "CA$", MinorUnits: 2},
+	"AUD": {Code: "AUD", Numeric: "036", Name: "Australian Dollar", Symbol: "A$", MinorUnits: 2},
+	"SEK": {Code: "SEK", Numeric: "752", Name: "Swedish Krona", Symbol: "kr", MinorUnits: 2},
+	"NOK": {Code: "NOK", Numeric: "578", Name: "Norwegian Krone", Symbol: "kr", MinorUnits: 2},
+	"PLN": {Code: "PLN", Numeric: "985", Name: "Zloty", Symbol: "zł", MinorUnits: 2},
+	"CZK": {Code: "CZK", Numeric: "203", Name: "Czech Koruna", Symbol: "Kč", MinorUnits: 2},
+	"UAH": {Code: "UAH", Numeric: "980", Name: "Hryvnia", Symbol: "₴", MinorUnits: 2},
+	"KZT": {Code: "KZT", Numeric: "398", Name: "Tenge", Symbol: "₸", MinorUnits: 2},
+	"TRY": {Code: "TRY", Numeric: "949", Name: "Turkish Lira", Symbol: "₺", MinorUnits: 2},
+	"INR": {Code: "INR", Numeric: "356", Name: "Indian Rupee", Symbol: "₹", MinorUnits: 2},
+	"BRL": {Code: "BRL", Numeric: "986", Name: "Brazilian Real", Symbol: "R$", MinorUnits: 2},
+	"KRW": {Code: "KRW", Numeric: "410", Name: "Won", Symbol: "₩", MinorUnits: 0},
+	"KWD": {Code: "KWD", Numeric: "414", Name: "Kuwaiti Dinar", Symbol: "KD", MinorUnits: 3},
+
+	"BTC":  {Code: "BTC", Name: "Bitcoin", Symbol: "₿", MinorUnits: 8, Crypto: true},
+	"ETH":  {Code: "ETH", Name: "Ether", Symbol: "Ξ", MinorUnits: 8, Crypto: true},
+	"LTC":  {Code: "LTC", Name: "Litecoin", Symbol: "Ł", MinorUnits: 8, Crypto: true},
+	"USDT": {Code: "USDT", Name: "Tether", Symbol: "₮", MinorUnits: 6, Crypto: true},
+}
+
+/*
+CurrencyOverride
+дополнение или изменение встроенной таблицы из конфигурации (ключ currencies)
+
+	currencies:
+	  USD:
+	    symbol: US$
+	  XMR:
+	    name: Monero
+	    symbol: ɱ
+	    minor_units: 12
+	    crypto: true
+
+незаданные поля берутся из встроенной таблицы
+*/
+type CurrencyOverride struct {
+	Numeric    string `mapstructure:"numeric"`
+	Name       string `mapstructure:"name"`
+	Symbol     string `mapstructure:"symbol"`
+	MinorUnits *int32 `mapstructure:"minor_units"`
+	Crypto     *bool  `mapstructure:"crypto"`
+}
+
+/*
+ParseCurrencyOverrides
+читает дополнения таблицы валют из конфигурации
+*/
+func ParseCurrencyOverrides(cfg *viper.Viper) (map[string]CurrencyOverride, error) {
+	overrides := map[string]CurrencyOverride{}
+	if err := cfg.UnmarshalKey("currencies", &overrides); err != nil {
+		return nil, err
+	}
+	return overrides, nil
+}
+
+/*
+CurrencyCatalog
+встроенная таблица валют с дополнениями из конфигурации
+*/
+type CurrencyCatalog struct {
+	m     sync.RWMutex
+	items map[string]CurrencyInfo
+}
+
+func NewCurrencyCatalog(overrides map[string]CurrencyOverride) *CurrencyCatalog {
+	c := &CurrencyCatalog{}
+	c.Set(overrides)
+	return c
+}
+
+/*
+Set
+заменяет дополнения из конфигурации (встроенная таблица не меняется)
+*/
+func (c *CurrencyCatalog) Set(overrides map[string]CurrencyOverride) {
+	items := make(map[string]CurrencyInfo, len(CurrencyTable)+len(overrides))
+	for k, v := range CurrencyTable {
+		items[k] = v
+	}
+	for code, o := range overrides {
+		code = strings.ToUpper(code)
+		info, ok := items[code]
+		if !ok {
+			info = defaultCurrencyInfo(code)
+		}
+		if o.Numeric != "" {
+			info.Numeric = o.Numeric
+		}
+		if o.Name != "" {
+			info.Name = o.Name
+		}
+		if o.Symbol != "" {
+			info.Symbol = o.Symbol
+		}
+		if o.MinorUnits != nil {
+			info.MinorUnits = *o.MinorUnits
+		}
+		if o.Crypto != nil {
+			info.Crypto = *o.Crypto
+		}
+		items[code] = info
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.items = items
+}
+
+/*
+Get
+сведения о валюте, для валюты которой нет в таблице - код вместо названия и символа
+*/
+func (c *CurrencyCatalog) Get(code string) (CurrencyInfo, bool) {
+	c.m.RLock()
+	defer c.m.RUnlock()
+	if info, ok := c.items[code]; ok {
+		return info, true
+	}
+	return defaultCurrencyInfo(code), false
+}
+
+func defaultCurrencyInfo(code string) CurrencyInfo {
+	return CurrencyInfo{
+		Code:       code,
+		Name:       code,
+		Symbol:     code,
+		MinorUnits: money.MinorUnitsOf(code),
+		Crypto:     IsCrypto(code),
+	}
+}
+
+/*
+Assets
+валюты которые входят в отслеживаемые пары, отсортированы по коду
+*/
+func (server *CurrencyServer) Assets() []string {
+	seen := map[string]bool{}
+	for _, pair := range server.Pairs() {
+		base, quote := SplitPair(pair)
+		if base != "" {
+			seen[base] = true
+			seen[quote] = true
+		}
+	}
+	assets := make([]string, 0, len(seen))
+	for code := range seen {
+		assets = append(assets, code)
+	}
+	sort.Strings(assets)
+	return assets
+}
+
+/*
+GetCurrencies
+GET /currencies - сведения о каждой валюте отслеживаемых пар
+*/
+func (server *CurrencyServer) GetCurrencies(w http.ResponseWriter, r *http.Request) {
+	assets := server.Assets()
+	currencies := make([]CurrencyInfo, 0, len(assets))
+	for _, code := range assets {
+		info, ok := server.Currencies.Get(code)
+		if !ok {
+			service.RequestLogger(r).Debugw("No metadata for currency - add it to currencies in config", "code", code)
+		}
+		currencies = append(currencies, info)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	json.NewEncoder(w).Encode(currencies)
+}
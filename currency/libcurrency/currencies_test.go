@@ -0,0 +1,81 @@
+package libcurrency
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SArtemJ/CurrencyGameExample/currency/money"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCurrencyTable(t *testing.T) {
+	for _, code := range append(append([]string{}, CryptoAssets...), FiatAssets...) {
+		info, ok := CurrencyTable[code]
+		if assert.True(t, ok, code) {
+			assert.Equal(t, code, info.Code)
+			assert.Equal(t, IsCrypto(code), info.Crypto, code)
+			assert.Equal(t, money.MinorUnitsOf(code), info.MinorUnits, code)
+		}
+	}
+}
+
+func TestCurrencyOverrides(t *testing.T) {
+	cfg := viper.New()
+	cfg.SetConfigType("yaml")
+	require.NoError(t, cfg.ReadConfig(bytes.NewBufferString(`
+currencies:
+  USD:
+    symbol: US$
+  XMR:
+    name: Monero
+    symbol: ɱ
+    minor_units: 12
+    crypto: true
+`)))
+	overrides, err := ParseCurrencyOverrides(cfg)
+	require.NoError(t, err)
+
+	catalog := NewCurrencyCatalog(overrides)
+	usd, ok := catalog.Get("USD")
+	assert.True(t, ok)
+	assert.Equal(t, "US$", usd.Symbol)
+	assert.Equal(t, "US Dollar", usd.Name)
+	assert.Equal(t, int32(2), usd.MinorUnits)
+
+	xmr, ok := catalog.Get("XMR")
+	assert.True(t, ok)
+	assert.Equal(t, CurrencyInfo{Code: "XMR", Name: "Monero", Symbol: "ɱ", MinorUnits: 12, Crypto: true}, xmr)
+
+	unknown, ok := catalog.Get("DOGE")
+	assert.False(t, ok)
+	assert.Equal(t, "DOGE", unknown.Symbol)
+
+	// встроенная таблица не меняется
+	assert.Equal(t, "$", CurrencyTable["USD"].Symbol)
+	catalog.Set(nil)
+	_, ok = catalog.Get("XMR")
+	assert.False(t, ok)
+}
+
+func TestGetCurrencies(t *testing.T) {
+	server := NewServer(CurrencyServerConfig{pairs: []string{"BTCUSD", "EURRUB", "ETHEUR"}})
+
+	req, _ := http.NewRequest("GET", "http://localhost:8888/api/currencies", nil)
+	w := httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var currencies []CurrencyInfo
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&currencies))
+	codes := []string{}
+	for _, c := range currencies {
+		codes = append(codes, c.Code)
+	}
+	assert.Equal(t, []string{"BTC", "ETH", "EUR", "RUB", "USD"}, codes)
+	assert.Equal(t, CurrencyTable["BTC"], currencies[0])
+}
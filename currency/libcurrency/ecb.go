@@ -0,0 +1,230 @@
+package libcurrency
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SArtemJ/CurrencyGameExample/currency/money"
+)
+
+const (
+	ECBDailyURL = "https://www.ecb.europa.eu/stats/eurofxref/eurofxref-daily.xml"
+	ECBBase     = "EUR"
+	// ECBTimeout - таймаут запроса к ECB по умолчанию
+	ECBTimeout = 10 * time.Second
+)
+
+var (
+	// ErrNoReferenceRate - валюты нет в справочнике ECB (RUB не публикуется с марта 2022)
+	ErrNoReferenceRate = errors.New("ecb: no reference rate")
+)
+
+/*
+ECBProvider
+получает справочные курсы фиатных валют к EUR в формате ECB (eurofxref-daily.xml)
+Source - url (http/https) или путь к локальному файлу
+Client - http клиент с таймаутом, запрос идет без блокировки кэша,
+одновременные запросы за устаревшими курсами ждут одну загрузку
+*/
+type ECBProvider struct {
+	Source   string
+	CacheTTL time.Duration
+	Client   *http.Client
+
+	m         sync.Mutex
+	rates     map[string]money.Amount
+	date      string
+	fetchedAt time.Time
+	loading   chan struct{}
+	loadErr   error
+}
+
+type ecbEnvelope struct {
+	Cube struct {
+		Days []struct {
+			Time  string `xml:"time,attr"`
+			Rates []struct {
+				Currency string `xml:"currency,attr"`
+				Rate     string `xml:"rate,attr"`
+			} `xml:"Cube"`
+		} `xml:"Cube"`
+	} `xml:"Cube"`
+}
+
+func NewECBProvider(source string, timeout time.Duration) *ECBProvider {
+	if source == "" {
+		source = ECBDailyURL
+	}
+	if timeout <= 0 {
+		timeout = ECBTimeout
+	}
+	return &ECBProvider{
+		Source:   source,
+		CacheTTL: time.Minute * 10,
+		Client:   &http.Client{Timeout: timeout},
+	}
+}
+
+/*
+Rates
+возвращает курсы EURxxx за последний день из источника
+EUR всегда равен 1
+*/
+func (p *ECBProvider) Rates(ctx context.Context) (map[string]money.Amount, error) {
+	p.m.Lock()
+	if p.rates != nil && time.Since(p.fetchedAt) < p.CacheTTL {
+		defer p.m.Unlock()
+		return p.rates, nil
+	}
+	loading := p.loading
+	if loading == nil {
+		loading = make(chan struct{})
+		p.loading = loading
+		go p.refresh(ctx, loading)
+	}
+	p.m.Unlock()
+
+	select {
+	case <-loading:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	p.m.Lock()
+	defer p.m.Unlock()
+	if p.loadErr != nil {
+		return nil, p.loadErr
+	}
+	return p.rates, nil
+}
+
+/*
+refresh
+общая загрузка курсов для всех ожидающих - не зависит от отмены запроса,
+который ее начал, ограничена таймаутом клиента
+*/
+func (p *ECBProvider) refresh(ctx context.Context, loading chan struct{}) {
+	var (
+		rates map[string]money.Amount
+		date  string
+		err   error
+	)
+	defer func() {
+		if r := recover(); r != nil {
+			Logger.Errorw("ECB load panic", "source", p.Source, "panic", r)
+			err = fmt.Errorf("ecb: load panic: %v", r)
+		}
+		p.m.Lock()
+		p.loading, p.loadErr = nil, err
+		if err == nil {
+			p.rates, p.date, p.fetchedAt = rates, date, time.Now()
+			Logger.Debugw("ECB reference rates loaded", "date", date, "source", p.Source)
+		}
+		p.m.Unlock()
+		close(loading)
+	}()
+
+	timeout := ECBTimeout
+	if p.Client != nil && p.Client.Timeout > 0 {
+		timeout = p.Client.Timeout
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+	rates, date, err = p.load(ctx)
+}
+
+func (p *ECBProvider) load(ctx context.Context) (map[string]money.Amount, string, error) {
+	body, err := p.open(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	defer body.Close()
+	return ParseECB(body)
+}
+
+/*
+Rate
+курс пары base/quote (например EURGBP или USDGBP через EUR)
+если в справочнике ECB нет валюты - ErrNoReferenceRate
+*/
+func (p *ECBProvider) Rate(ctx context.Context, base, quote string) (money.Amount, error) {
+	rates, err := p.Rates(ctx)
+	if err != nil {
+		return money.Zero, err
+	}
+	b, ok := rates[base]
+	if !ok {
+		return money.Zero, fmt.Errorf("%w for %s", ErrNoReferenceRate, base)
+	}
+	q, ok := rates[quote]
+	if !ok {
+		return money.Zero, fmt.Errorf("%w for %s", ErrNoReferenceRate, quote)
+	}
+	return q.Div(b)
+}
+
+func (p *ECBProvider) Supports(ctx context.Context, code string) bool {
+	rates, err := p.Rates(ctx)
+	if err != nil {
+		return false
+	}
+	_, ok := rates[code]
+	return ok
+}
+
+func (p *ECBProvider) open(ctx context.Context) (io.ReadCloser, error) {
+	if strings.HasPrefix(p.Source, "http://") || strings.HasPrefix(p.Source, "https://") {
+		req, err := http.NewRequest("GET", p.Source, nil)
+		if err != nil {
+			return nil, err
+		}
+		res, err := p.Client.Do(req.WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode != http.StatusOK {
+			res.Body.Close()
+			return nil, fmt.Errorf("ecb: %s returned %s", p.Source, res.Status)
+		}
+		return res.Body, nil
+	}
+	return os.Open(strings.TrimPrefix(p.Source, "file://"))
+}
+
+/*
+ParseECB
+разбирает XML в формате ECB, возвращает курсы за самый свежий день и его дату
+*/
+func ParseECB(r io.Reader) (map[string]money.Amount, string, error) {
+	var env ecbEnvelope
+	if err := xml.NewDecoder(r).Decode(&env); err != nil {
+		return nil, "", err
+	}
+	if len(env.Cube.Days) == 0 {
+		return nil, "", fmt.Errorf("ecb: no rates in document")
+	}
+
+	latest := env.Cube.Days[0]
+	for _, d := range env.Cube.Days[1:] {
+		if d.Time > latest.Time {
+			latest = d
+		}
+	}
+
+	rates := map[string]money.Amount{ECBBase: money.New(1, 0)}
+	for _, v := range latest.Rates {
+		rate, err := money.Parse(v.Rate)
+		if err != nil {
+			return nil, "", fmt.Errorf("ecb: bad rate for %s: %v", v.Currency, err)
+		}
+		rates[v.Currency] = rate
+	}
+	return rates, latest.Time, nil
+}
@@ -0,0 +1,142 @@
+package libcurrency
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const ecbTestXML = `<?xml version="1.0" encoding="UTF-8"?>
+<gesmes:Envelope xmlns:gesmes="http://www.gesmes.org/xml/2002-08-01" xmlns="http://www.ecb.int/vocabulary/2002-08-01/eurofxref">
+	<gesmes:subject>Reference rates</gesmes:subject>
+	<Cube>
+		<Cube time="2018-07-13">
+			<Cube currency="USD" rate="1.1666"/>
+			<Cube currency="GBP" rate="0.88460"/>
+			<Cube currency="RUB" rate="72.9000"/>
+		</Cube>
+		<Cube time="2018-07-16">
+			<Cube currency="USD" rate="1.1720"/>
+			<Cube currency="GBP" rate="0.88500"/>
+			<Cube currency="RUB" rate="73.1080"/>
+		</Cube>
+	</Cube>
+</gesmes:Envelope>`
+
+func TestParseECB(t *testing.T) {
+	rates, date, err := ParseECB(strings.NewReader(ecbTestXML))
+	require.NoError(t, err)
+	assert.Equal(t, "2018-07-16", date)
+	assert.Equal(t, "1.172", rates["USD"].String())
+	assert.Equal(t, "73.108", rates["RUB"].String())
+	assert.Equal(t, "1", rates["EUR"].String())
+}
+
+func TestECBProviderFromFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "eurofxref")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	f.WriteString(ecbTestXML)
+	f.Close()
+
+	p := NewECBProvider(f.Name(), 0)
+	ctx := context.Background()
+	rate, err := p.Rate(ctx, "EUR", "RUB")
+	require.NoError(t, err)
+	assert.Equal(t, "73.108", rate.String())
+
+	rate, err = p.Rate(ctx, "USD", "RUB")
+	require.NoError(t, err)
+	assert.Equal(t, "62.38", rate.Round("RUB").String())
+
+	_, err = p.Rate(ctx, "USD", "JPY")
+	assert.True(t, errors.Is(err, ErrNoReferenceRate))
+}
+
+func TestECBProviderTimeout(t *testing.T) {
+	release := make(chan struct{})
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer hung.Close()
+	defer close(release)
+
+	p := NewECBProvider(hung.URL, 50*time.Millisecond)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := p.Rates(context.Background())
+			assert.Error(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.True(t, time.Since(start) < 2*time.Second)
+
+	// отмена запроса не ждет таймаута клиента
+	p = NewECBProvider(hung.URL, time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := p.Rate(ctx, "EUR", "USD")
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < 2*time.Second)
+}
+
+func TestECBProviderSharedLoad(t *testing.T) {
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	var requests int32
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		started <- struct{}{}
+		<-release
+		io.WriteString(w, ecbTestXML)
+	}))
+	defer slow.Close()
+
+	p := NewECBProvider(slow.URL, time.Minute)
+
+	// первый запрос начинает загрузку и отменяется
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := p.Rates(ctx)
+		first <- err
+	}()
+	<-started
+	cancel()
+	assert.Equal(t, context.Canceled, <-first)
+
+	// ожидающий получает курсы той же загрузки
+	second := make(chan error, 1)
+	go func() {
+		_, err := p.Rate(context.Background(), "EUR", "USD")
+		second <- err
+	}()
+	close(release)
+	assert.NoError(t, <-second)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
+
+func TestIsFiatPair(t *testing.T) {
+	assert.True(t, IsFiatPair("EURRUB"))
+	assert.False(t, IsFiatPair("BTCRUB"))
+	assert.False(t, IsFiatPair("USDTRUB"))
+	assert.False(t, IsFiatPair("BTC"))
+}
@@ -0,0 +1,234 @@
+package libcurrency
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SArtemJ/CurrencyGameExample/currency/service"
+	"github.com/go-redis/redis"
+	"github.com/gorilla/mux"
+)
+
+const (
+	ExportFormatCSV   = "csv"
+	ExportFormatJSONL = "jsonl"
+
+	// сколько значений истории читается из Redis за один запрос
+	HistoryScanBatch = 1000
+)
+
+/*
+ScanHistory
+читает историю пары за период [from, to] частями по HistoryScanBatch значений
+и передает каждое значение в fn, вся история в памяти не хранится
+следующая часть читается от последнего прочитанного значения (score, member), а не по смещению от начала -
+время чтения не растет с номером части и значения добавленные во время чтения не сдвигают уже прочитанные
+*/
+func (server *CurrencyServer) ScanHistory(ctx context.Context, pair string, from, to time.Time, fn func(RatePoint) error) error {
+	opt := redis.ZRangeBy{Min: "-inf", Max: "+inf", Count: HistoryScanBatch}
+	if !from.IsZero() {
+		opt.Min = strconv.FormatInt(from.Unix(), 10)
+	}
+	if !to.IsZero() {
+		opt.Max = strconv.FormatInt(to.Unix(), 10)
+	}
+
+	// последнее прочитанное значение и сколько прочитано значений с его score
+	var lastScore float64
+	var lastMember string
+	var tie int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		values, err := server.rdb(ctx).ZRangeByScoreWithScores(historyKey(pair), opt).Result()
+		if err != nil {
+			return err
+		}
+		for _, z := range values {
+			m, _ := z.Member.(string)
+			// значения с тем же score упорядочены по member - уже прочитанные пропускаются
+			// (значение добавленное перед последним прочитанным сдвигает их на одну позицию)
+			if lastMember != "" && z.Score == lastScore && m <= lastMember {
+				tie++
+				continue
+			}
+			if z.Score == lastScore {
+				tie++
+			} else {
+				lastScore, tie = z.Score, 1
+			}
+			lastMember = m
+
+			p, err := parseHistoryMember(m)
+			if err != nil {
+				Logger.Debugw("Bad history value in Redis", "pair", pair, "value", m)
+				continue
+			}
+			if err := fn(p); err != nil {
+				return err
+			}
+		}
+		if int64(len(values)) < opt.Count {
+			return nil
+		}
+		// смещение только внутри значений с последним score (одна секунда истории)
+		opt.Min = strconv.FormatFloat(lastScore, 'f', -1, 64)
+		opt.Offset = tie
+	}
+}
+
+/*
+HistoryEncoder
+построчная запись истории курса в формате csv или jsonl
+*/
+type HistoryEncoder interface {
+	Encode(pair string, p RatePoint) error
+	Flush() error
+}
+
+/*
+NewHistoryEncoder
+format - csv (с заголовком time,pair,value) или jsonl (один JSON объект в строке)
+*/
+func NewHistoryEncoder(w io.Writer, format string) (HistoryEncoder, error) {
+	switch strings.ToLower(format) {
+	case "", ExportFormatCSV:
+		enc := &csvHistoryEncoder{w: csv.NewWriter(w)}
+		if err := enc.w.Write([]string{"time", "pair", "value"}); err != nil {
+			return nil, err
+		}
+		return enc, nil
+	case ExportFormatJSONL:
+		return &jsonlHistoryEncoder{enc: json.NewEncoder(w)}, nil
+	}
+	return nil, fmt.Errorf("unknown export format %q", format)
+}
+
+/*
+ExportContentType
+тип содержимого ответа для формата выгрузки
+*/
+func ExportContentType(format string) string {
+	if strings.ToLower(format) == ExportFormatJSONL {
+		return "application/x-ndjson; charset=UTF-8"
+	}
+	return "text/csv; charset=UTF-8"
+}
+
+type csvHistoryEncoder struct {
+	w *csv.Writer
+}
+
+func (e *csvHistoryEncoder) Encode(pair string, p RatePoint) error {
+	return e.w.Write([]string{p.Time.Format(time.RFC3339Nano), pair, p.Value.String()})
+}
+
+func (e *csvHistoryEncoder) Flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type jsonlHistoryEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *jsonlHistoryEncoder) Encode(pair string, p RatePoint) error {
+	return e.enc.Encode(struct {
+		Time  time.Time `json:"time"`
+		Pair  string    `json:"pair"`
+		Value string    `json:"value"`
+	}{p.Time, pair, p.Value.String()})
+}
+
+func (e *jsonlHistoryEncoder) Flush() error {
+	return nil
+}
+
+/*
+ExportHistory
+записывает историю пары за период в w в формате format
+возвращает количество записанных строк
+*/
+func (server *CurrencyServer) ExportHistory(ctx context.Context, w io.Writer, pair, format string, from, to time.Time) (int, error) {
+	enc, err := NewHistoryEncoder(w, format)
+	if err != nil {
+		return 0, err
+	}
+	flusher, _ := w.(http.Flusher)
+	rows := 0
+	err = server.ScanHistory(ctx, pair, from, to, func(p RatePoint) error {
+		if err := enc.Encode(pair, p); err != nil {
+			return err
+		}
+		rows++
+		// отдаем клиенту данные по мере чтения из Redis
+		if rows%HistoryScanBatch == 0 {
+			if err := enc.Flush(); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return rows, err
+	}
+	return rows, enc.Flush()
+}
+
+/*
+ExportCurrencyHistory
+GET /history/{type}/export?format=csv|jsonl&from=&to=
+выгрузка истории курса для таблиц, строки пишутся в ответ по мере чтения из Redis
+*/
+func (server *CurrencyServer) ExportCurrencyHistory(w http.ResponseWriter, r *http.Request) {
+	logger := service.RequestLogger(r)
+	typeC := mux.Vars(r)["type"]
+	if !server.HasPair(typeC) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "Bad request incorrect type currency")
+		logger.Debugw("Not exist type of currency for export method", "err ", typeC)
+		return
+	}
+
+	format := strings.ToLower(r.FormValue("format"))
+	if format == "" {
+		format = ExportFormatCSV
+	}
+	if format != ExportFormatCSV && format != ExportFormatJSONL {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "Bad request incorrect format - csv or jsonl")
+		return
+	}
+
+	from, to, err := ParsePeriod(r.FormValue("since"), r.FormValue("from"), r.FormValue("to"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "Bad request incorrect period - "+err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", ExportContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, typeC, format))
+	rows, err := server.ExportHistory(r.Context(), w, typeC, format, from, to)
+	if err != nil {
+		logger.Debugw("Can't export history", "pair", typeC, "rows", rows, "err", err)
+		// после начала ответа статус изменить уже нельзя
+		if rows == 0 {
+			w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+			w.Header().Del("Content-Disposition")
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, "Can't get history from Redis")
+		}
+	}
+}
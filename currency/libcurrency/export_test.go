@@ -0,0 +1,34 @@
+package libcurrency
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/SArtemJ/CurrencyGameExample/currency/money"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistoryEncoder(t *testing.T) {
+	p := RatePoint{Time: time.Date(2018, 7, 16, 10, 0, 0, 0, time.UTC), Value: money.MustParse("6500.10")}
+
+	var b bytes.Buffer
+	enc, err := NewHistoryEncoder(&b, "csv")
+	require.NoError(t, err)
+	require.NoError(t, enc.Encode("BTCUSD", p))
+	require.NoError(t, enc.Flush())
+	assert.Equal(t, "time,pair,value\n2018-07-16T10:00:00Z,BTCUSD,6500.1\n", b.String())
+
+	b.Reset()
+	enc, err = NewHistoryEncoder(&b, "JSONL")
+	require.NoError(t, err)
+	require.NoError(t, enc.Encode("BTCUSD", p))
+	require.NoError(t, enc.Encode("BTCUSD", p))
+	require.NoError(t, enc.Flush())
+	assert.Equal(t, `{"time":"2018-07-16T10:00:00Z","pair":"BTCUSD","value":"6500.1"}`+"\n"+
+		`{"time":"2018-07-16T10:00:00Z","pair":"BTCUSD","value":"6500.1"}`+"\n", b.String())
+
+	_, err = NewHistoryEncoder(&b, "xls")
+	assert.Error(t, err)
+}
@@ -0,0 +1,306 @@
+package libcurrency
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SArtemJ/CurrencyGameExample/currency/money"
+	"github.com/SArtemJ/CurrencyGameExample/currency/service"
+	"github.com/go-redis/redis"
+)
+
+const (
+	QuarantineStream = "quarantine:rates"
+	// сколько последних отклоненных значений хранится в Redis
+	QuarantineMaxLen = 10000
+
+	DefaultGuardDeviation     = 20.0
+	DefaultGuardConfirmations = 3
+)
+
+/*
+RateGuard
+защита от ошибочных значений внешних источников (0, скачок в 100 раз)
+значение которое отличается от текущего больше чем на MaxDeviation процентов отклоняется,
+пока Confirmations подряд полученных значений не подтвердят его (каждое в пределах MaxDeviation от предыдущего)
+MaxDeviation = 0 - проверка отключена
+*/
+type RateGuard struct {
+	m             sync.Mutex
+	maxDeviation  float64
+	confirmations int
+	suspects      map[string]suspectRun
+}
+
+// подряд полученные отклоненные значения пары
+type suspectRun struct {
+	value money.Amount
+	count int
+}
+
+/*
+GuardDecision
+результат проверки нового значения
+Confirmed - сколько значений подряд подтверждают новый уровень (вместе с этим)
+*/
+type GuardDecision struct {
+	Accept    bool
+	Reason    string
+	Deviation float64
+	Confirmed int
+	Required  int
+}
+
+func NewRateGuard(maxDeviation float64, confirmations int) *RateGuard {
+	g := &RateGuard{suspects: map[string]suspectRun{}}
+	g.Set(maxDeviation, confirmations)
+	return g
+}
+
+/*
+Set
+меняет параметры проверки на работающем сервере
+*/
+func (g *RateGuard) Set(maxDeviation float64, confirmations int) {
+	g.m.Lock()
+	defer g.m.Unlock()
+	if maxDeviation < 0 {
+		maxDeviation = 0
+	}
+	if confirmations < 1 {
+		confirmations = 1
+	}
+	g.maxDeviation = maxDeviation
+	g.confirmations = confirmations
+}
+
+/*
+Check
+проверяет новое значение пары относительно текущего old
+нулевое и отрицательное значение отклоняется всегда, при old = 0 (курса еще нет) принимается любое положительное
+*/
+func (g *RateGuard) Check(pair string, old, value money.Amount) GuardDecision {
+	g.m.Lock()
+	defer g.m.Unlock()
+	d := GuardDecision{Required: g.confirmations}
+
+	if value.Sign() <= 0 {
+		d.Reason = "non-positive value"
+		return d
+	}
+	if g.maxDeviation == 0 || old.Sign() <= 0 {
+		delete(g.suspects, pair)
+		d.Accept = true
+		return d
+	}
+
+	d.Deviation = deviation(old, value)
+	if d.Deviation <= g.maxDeviation {
+		delete(g.suspects, pair)
+		d.Accept = true
+		return d
+	}
+
+	run, ok := g.suspects[pair]
+	if ok && deviation(run.value, value) <= g.maxDeviation {
+		run.count++
+	} else {
+		run.count = 1
+	}
+	run.value = value
+	d.Confirmed = run.count
+	if run.count >= g.confirmations {
+		delete(g.suspects, pair)
+		d.Accept = true
+		d.Reason = fmt.Sprintf("confirmed by %d samples", run.count)
+		return d
+	}
+	g.suspects[pair] = run
+	d.Reason = fmt.Sprintf("deviation %.2f%% exceeds %.2f%%", d.Deviation, g.maxDeviation)
+	return d
+}
+
+// отклонение value от base в процентах
+func deviation(base, value money.Amount) float64 {
+	ratio, err := value.Sub(base).Div(base)
+	if err != nil {
+		return 0
+	}
+	return math.Abs(ratio.Float64()) * 100
+}
+
+/*
+QuarantineEntry
+отклоненное значение курса
+*/
+type QuarantineEntry struct {
+	ID        string       `json:"id"`
+	Time      time.Time    `json:"time"`
+	Pair      string       `json:"pair"`
+	Current   money.Amount `json:"current"`
+	Rejected  money.Amount `json:"rejected"`
+	Deviation string       `json:"deviation"`
+	Reason    string       `json:"reason"`
+	Confirmed int          `json:"confirmed"`
+	Required  int          `json:"required"`
+	Provider  string       `json:"provider"`
+	Actor     string       `json:"actor"`
+}
+
+type ReturnQuarantine struct {
+	Entries []QuarantineEntry `json:"entries"`
+	Next    string            `json:"next,omitempty"`
+}
+
+/*
+GuardRate
+проверяет значение из внешнего источника и сохраняет его (SaveRate)
+или записывает в карантин (Redis stream quarantine:rates)
+возвращает false если значение отклонено или не записано в Redis
+значение для зафиксированной пары не записывается (ErrPinned), результат - true как для обновления с фиксацией
+*/
+func (server *CurrencyServer) GuardRate(ctx context.Context, pair string, value money.Amount, actor Actor, provider string) bool {
+	old := server.GetRValue(ctx, pair)
+	d := server.Guard.Check(pair, old, value)
+	if !d.Accept {
+		Logger.Warnw("Rate rejected by guard - quarantined",
+			"pair", pair, "current", old.String(), "rejected", value.String(),
+			"reason", d.Reason, "confirmed", d.Confirmed, "required", d.Required)
+		server.AddQuarantine(ctx, pair, old, value, d, actor, provider)
+		return false
+	}
+	if d.Reason != "" {
+		Logger.Infow("Rate accepted by guard", "pair", pair, "current", old.String(), "new", value.String(), "reason", d.Reason)
+	}
+	if err := server.SaveRate(ctx, pair, value, actor, provider); err != nil && err != ErrPinned {
+		return false
+	}
+	return true
+}
+
+/*
+AddQuarantine
+добавляет отклоненное значение в Redis stream quarantine:rates (хранятся последние QuarantineMaxLen)
+*/
+func (server *CurrencyServer) AddQuarantine(ctx context.Context, pair string, current, rejected money.Amount, d GuardDecision, actor Actor, provider string) {
+	err := server.rdb(ctx).XAdd(&redis.XAddArgs{
+		Stream:       QuarantineStream,
+		MaxLenApprox: QuarantineMaxLen,
+		ID:           "*",
+		Values: map[string]interface{}{
+			"pair":      pair,
+			"current":   current.String(),
+			"rejected":  rejected.String(),
+			"deviation": strconv.FormatFloat(d.Deviation, 'f', 2, 64),
+			"reason":    d.Reason,
+			"confirmed": d.Confirmed,
+			"required":  d.Required,
+			"provider":  provider,
+			"actor":     actor.Name,
+		},
+	}).Err()
+	if err != nil {
+		Logger.Debugw("Can't save quarantine entry to Redis", "pair", pair, "err", err)
+	}
+}
+
+/*
+GetQuarantineEntries
+отклоненные значения от новых к старым начиная с before (включительно, пусто - с последнего)
+pair - только значения пары (пусто - все пары)
+*/
+func (server *CurrencyServer) GetQuarantineEntries(ctx context.Context, pair, before string, count int64) ([]QuarantineEntry, string, error) {
+	if before == "" {
+		before = "+"
+	}
+	entries := make([]QuarantineEntry, 0, count)
+	for {
+		messages, err := server.rdb(ctx).XRevRangeN(QuarantineStream, before, "-", count+1).Result()
+		if err != nil {
+			return nil, "", err
+		}
+		more := int64(len(messages)) > count
+		if more {
+			before = messages[count].ID
+			messages = messages[:count]
+		}
+		for _, m := range messages {
+			e := quarantineEntryFromMessage(m)
+			if pair != "" && e.Pair != pair {
+				continue
+			}
+			if int64(len(entries)) == count {
+				return entries, m.ID, nil
+			}
+			entries = append(entries, e)
+		}
+		if !more {
+			return entries, "", nil
+		}
+	}
+}
+
+func quarantineEntryFromMessage(m redis.XMessage) QuarantineEntry {
+	str := func(key string) string {
+		v, _ := m.Values[key].(string)
+		return v
+	}
+	e := QuarantineEntry{
+		ID:        m.ID,
+		Pair:      str("pair"),
+		Deviation: str("deviation"),
+		Reason:    str("reason"),
+		Provider:  str("provider"),
+		Actor:     str("actor"),
+	}
+	e.Current, _ = money.Parse(str("current"))
+	e.Rejected, _ = money.Parse(str("rejected"))
+	e.Confirmed, _ = strconv.Atoi(str("confirmed"))
+	e.Required, _ = strconv.Atoi(str("required"))
+	if ms, err := strconv.ParseInt(strings.Split(m.ID, "-")[0], 10, 64); err == nil {
+		e.Time = time.Unix(0, ms*int64(time.Millisecond)).UTC()
+	}
+	return e
+}
+
+/*
+GetQuarantine
+GET /admin/quarantine?pair=BTCUSD&count=50&before=<id>
+*/
+func (server *CurrencyServer) GetQuarantine(w http.ResponseWriter, r *http.Request) {
+	logger := service.RequestLogger(r)
+	count := int64(50)
+	if v := r.FormValue("count"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 || n > 500 {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, "Bad request incorrect count (1-500)")
+			return
+		}
+		count = n
+	}
+	pair := strings.ToUpper(r.FormValue("pair"))
+	if pair != "" && !server.HasPair(pair) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "Bad request incorrect type currency")
+		return
+	}
+
+	entries, next, err := server.GetQuarantineEntries(r.Context(), pair, r.FormValue("before"), count)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, "Can't get quarantine from Redis")
+		logger.Debugw("Can't get quarantine from Redis", "err", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	json.NewEncoder(w).Encode(ReturnQuarantine{Entries: entries, Next: next})
+}
@@ -0,0 +1,49 @@
+package libcurrency
+
+import (
+	"testing"
+
+	"github.com/SArtemJ/CurrencyGameExample/currency/money"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateGuard(t *testing.T) {
+	g := NewRateGuard(20, 3)
+	current := money.MustParse("6500")
+
+	// курса еще нет - принимается любое положительное значение
+	assert.True(t, g.Check("BTCUSD", money.Zero, current).Accept)
+	assert.True(t, g.Check("BTCUSD", current, money.MustParse("7000")).Accept)
+
+	d := g.Check("BTCUSD", current, money.Zero)
+	assert.False(t, d.Accept)
+	assert.Equal(t, "non-positive value", d.Reason)
+
+	// скачок в 100 раз, потом нормальное значение - скачок забывается
+	d = g.Check("BTCUSD", current, money.MustParse("650000"))
+	assert.False(t, d.Accept)
+	assert.Equal(t, 1, d.Confirmed)
+	assert.Equal(t, 3, d.Required)
+	assert.InDelta(t, 9900, d.Deviation, 0.001)
+	assert.True(t, g.Check("BTCUSD", current, money.MustParse("6510")).Accept)
+	d = g.Check("BTCUSD", current, money.MustParse("650000"))
+	assert.Equal(t, 1, d.Confirmed)
+
+	// новый уровень подтверждают три значения подряд
+	d = g.Check("BTCUSD", current, money.MustParse("9000"))
+	assert.False(t, d.Accept)
+	assert.Equal(t, 1, d.Confirmed)
+	d = g.Check("BTCUSD", current, money.MustParse("9100"))
+	assert.False(t, d.Accept)
+	assert.Equal(t, 2, d.Confirmed)
+	d = g.Check("BTCUSD", current, money.MustParse("9050"))
+	assert.True(t, d.Accept)
+	assert.Equal(t, 3, d.Confirmed)
+
+	// другие пары проверяются отдельно
+	assert.Equal(t, 1, g.Check("BTCEUR", money.MustParse("5500"), money.MustParse("9000")).Confirmed)
+
+	g.Set(0, 3)
+	assert.True(t, g.Check("BTCUSD", current, money.MustParse("650000")).Accept)
+	assert.False(t, g.Check("BTCUSD", current, money.Zero).Accept)
+}
@@ -0,0 +1,205 @@
+package libcurrency
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/SArtemJ/CurrencyGameExample/currency/money"
+	"github.com/go-redis/redis"
+)
+
+const (
+	HistoryKeyPrefix = "history:"
+	// DefaultHistoryRetention - сколько хранится история курса (history.retention)
+	DefaultHistoryRetention = "90d"
+)
+
+/*
+RatePoint
+значение курса в момент времени
+*/
+type RatePoint struct {
+	Time  time.Time    `json:"time"`
+	Value money.Amount `json:"value"`
+}
+
+func historyKey(pair string) string {
+	return HistoryKeyPrefix + pair
+}
+
+/*
+ParseRetention
+срок хранения истории в формате ParseSince (90d, 720h), 0 - без ограничения
+*/
+func ParseRetention(value string) (time.Duration, error) {
+	d, err := ParseSince(value)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("negative history retention %q", value)
+	}
+	return d, nil
+}
+
+/*
+SetHistoryRetention
+срок хранения истории, значения старше удаляются при записи, 0 - без ограничения
+*/
+func (server *CurrencyServer) SetHistoryRetention(d time.Duration) {
+	atomic.StoreInt64(&server.historyRetention, int64(d))
+}
+
+func (server *CurrencyServer) HistoryRetention() time.Duration {
+	return time.Duration(atomic.LoadInt64(&server.historyRetention))
+}
+
+/*
+historyCutoff
+значения истории раньше этого времени удаляются, нулевое время - без ограничения
+*/
+func (server *CurrencyServer) historyCutoff() time.Time {
+	retention := server.HistoryRetention()
+	if retention <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(-retention).Truncate(time.Second)
+}
+
+/*
+trimHistory
+добавляет в pipe удаление значений истории старше срока хранения
+*/
+func (server *CurrencyServer) trimHistory(pipe redis.Pipeliner, pair string) {
+	cutoff := server.historyCutoff()
+	if cutoff.IsZero() {
+		return
+	}
+	pipe.ZRemRangeByScore(historyKey(pair), "-inf", "("+strconv.FormatInt(cutoff.Unix(), 10))
+}
+
+/*
+AddHistory
+сохраняет значение курса в историю пары и удаляет значения старше срока хранения
+история хранится в Redis sorted set - score = unix время, member = "unixnano:value"
+*/
+func (server *CurrencyServer) AddHistory(ctx context.Context, pair string, value money.Amount, t time.Time) bool {
+	member := strconv.FormatInt(t.UnixNano(), 10) + ":" + value.String()
+	pipe := server.rdb(ctx).TxPipeline()
+	pipe.ZAdd(historyKey(pair), redis.Z{
+		Score:  float64(t.Unix()),
+		Member: member,
+	})
+	server.trimHistory(pipe, pair)
+	_, err := pipe.Exec()
+	if err != nil {
+		Logger.Debugw("Can't save history value to Redis", "pair", pair, "err", err)
+		return false
+	}
+	return true
+}
+
+/*
+GetHistory
+возвращает историю курса пары за период [from, to] в порядке возрастания времени
+нулевое значение from/to - без ограничения
+*/
+func (server *CurrencyServer) GetHistory(ctx context.Context, pair string, from, to time.Time) ([]RatePoint, error) {
+	opt := redis.ZRangeBy{Min: "-inf", Max: "+inf"}
+	if !from.IsZero() {
+		opt.Min = strconv.FormatInt(from.Unix(), 10)
+	}
+	if !to.IsZero() {
+		opt.Max = strconv.FormatInt(to.Unix(), 10)
+	}
+
+	members, err := server.rdb(ctx).ZRangeByScore(historyKey(pair), opt).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	points := make([]RatePoint, 0, len(members))
+	for _, m := range members {
+		p, err := parseHistoryMember(m)
+		if err != nil {
+			Logger.Debugw("Bad history value in Redis", "pair", pair, "value", m)
+			continue
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
+
+func parseHistoryMember(m string) (RatePoint, error) {
+	parts := strings.SplitN(m, ":", 2)
+	if len(parts) != 2 {
+		return RatePoint{}, fmt.Errorf("bad history member %q", m)
+	}
+	ns, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return RatePoint{}, err
+	}
+	value, err := money.Parse(parts[1])
+	if err != nil {
+		return RatePoint{}, err
+	}
+	return RatePoint{Time: time.Unix(0, ns).UTC(), Value: value}, nil
+}
+
+/*
+ParseSince
+разбирает период вида 90m, 24h, 7d
+*/
+func ParseSince(since string) (time.Duration, error) {
+	if strings.HasSuffix(since, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(since, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("bad period %q", since)
+		}
+		return time.Duration(days) * time.Hour * 24, nil
+	}
+	return time.ParseDuration(since)
+}
+
+/*
+ParseTime
+разбирает время в формате RFC3339 или unix время в секундах
+*/
+func ParseTime(value string) (time.Time, error) {
+	if sec, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(sec, 0).UTC(), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+/*
+ParsePeriod
+границы периода по параметрам since, from, to
+since имеет приоритет над from
+*/
+func ParsePeriod(since, from, to string) (time.Time, time.Time, error) {
+	var tFrom, tTo time.Time
+	var err error
+	if from != "" {
+		if tFrom, err = ParseTime(from); err != nil {
+			return tFrom, tTo, fmt.Errorf("bad from %q", from)
+		}
+	}
+	if to != "" {
+		if tTo, err = ParseTime(to); err != nil {
+			return tFrom, tTo, fmt.Errorf("bad to %q", to)
+		}
+	}
+	if since != "" {
+		d, err := ParseSince(since)
+		if err != nil {
+			return tFrom, tTo, err
+		}
+		tFrom = time.Now().Add(-d)
+	}
+	return tFrom, tTo, nil
+}
@@ -0,0 +1,252 @@
+package libcurrency
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/SArtemJ/CurrencyGameExample/currency/money"
+	"github.com/SArtemJ/CurrencyGameExample/currency/service"
+	"github.com/go-redis/redis"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// сколько ошибок в строках возвращается в итоге импорта
+	ImportMaxErrors = 20
+)
+
+/*
+ImportSummary
+итог импорта истории
+Inserted - добавлено значений, Skipped - уже были в истории (или повторяются в файле),
+Invalid - строки которые не удалось разобрать
+*/
+type ImportSummary struct {
+	Pair     string   `json:"pair"`
+	Read     int      `json:"read"`
+	Inserted int      `json:"inserted"`
+	Skipped  int      `json:"skipped"`
+	Invalid  int      `json:"invalid"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+func (s *ImportSummary) String() string {
+	return fmt.Sprintf("%s: read %d, inserted %d, skipped %d (already exist), invalid %d",
+		s.Pair, s.Read, s.Inserted, s.Skipped, s.Invalid)
+}
+
+func (s *ImportSummary) invalid(line int, err error) {
+	s.Invalid++
+	if len(s.Errors) < ImportMaxErrors {
+		s.Errors = append(s.Errors, fmt.Sprintf("line %d: %v", line, err))
+	}
+}
+
+/*
+ReadHistoryCSV
+читает значения курса пары из CSV в формате выгрузки (time,pair,value) или time,value
+первая строка - заголовок, time в формате RFC3339 или unix время в секундах
+строки другой пары и строки с ошибками учитываются в summary как invalid
+fn вызывается для каждой разобранной строки
+*/
+func ReadHistoryCSV(r io.Reader, pair string, summary *ImportSummary, fn func(RatePoint) error) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	timeCol, okTime := columns["time"]
+	valueCol, okValue := columns["value"]
+	if !okTime || !okValue {
+		return fmt.Errorf("CSV header must contain time and value columns, got %q", strings.Join(header, ","))
+	}
+	pairCol, okPair := columns["pair"]
+
+	line := 1
+	for {
+		record, err := reader.Read()
+		line++
+		if err == io.EOF {
+			return nil
+		}
+		summary.Read++
+		if err != nil {
+			summary.invalid(line, err)
+			continue
+		}
+		if len(record) <= timeCol || len(record) <= valueCol || (okPair && len(record) <= pairCol) {
+			summary.invalid(line, fmt.Errorf("wrong number of fields"))
+			continue
+		}
+		if okPair && strings.ToUpper(record[pairCol]) != pair {
+			summary.invalid(line, fmt.Errorf("pair %s instead of %s", record[pairCol], pair))
+			continue
+		}
+		t, err := ParseTime(record[timeCol])
+		if err != nil {
+			summary.invalid(line, fmt.Errorf("bad time %q", record[timeCol]))
+			continue
+		}
+		value, err := money.Parse(record[valueCol])
+		if err != nil || value.Sign() <= 0 {
+			summary.invalid(line, fmt.Errorf("bad value %q", record[valueCol]))
+			continue
+		}
+		if err := fn(RatePoint{Time: t.UTC(), Value: value}); err != nil {
+			return err
+		}
+	}
+}
+
+/*
+ImportHistory
+загружает историю пары из CSV
+значение с тем же временем что уже есть в истории пропускается
+строки обрабатываются частями по HistoryScanBatch, файл и история целиком в памяти не хранятся
+если что-то добавлено - версия пары меняется, кеш статистики (/stats) сбрасывается на всех экземплярах
+*/
+func (server *CurrencyServer) ImportHistory(ctx context.Context, r io.Reader, pair string) (*ImportSummary, error) {
+	summary := &ImportSummary{Pair: pair}
+	batch := make([]RatePoint, 0, HistoryScanBatch)
+
+	err := ReadHistoryCSV(r, pair, summary, func(p RatePoint) error {
+		batch = append(batch, p)
+		if len(batch) < HistoryScanBatch {
+			return nil
+		}
+		err := server.importBatch(ctx, pair, batch, summary)
+		batch = batch[:0]
+		return err
+	})
+	if err == nil && len(batch) > 0 {
+		err = server.importBatch(ctx, pair, batch, summary)
+	}
+	if summary.Inserted > 0 {
+		if verr := server.touchPair(ctx, pair); verr != nil && err == nil {
+			err = verr
+		}
+	}
+	return summary, err
+}
+
+/*
+touchPair
+меняет версию пары и курсов без изменения значения - кеши по версии (статистика, ETag) сбрасываются
+*/
+func (server *CurrencyServer) touchPair(ctx context.Context, pair string) error {
+	_, err := server.rdb(ctx).TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.Incr(VersionKey)
+		pipe.HIncrBy(metaKey(pair), "version", 1)
+		return nil
+	})
+	return err
+}
+
+/*
+importBatch
+отбрасывает значения время которых уже есть в истории или в этой части файла и добавляет остальные одним pipeline
+из истории читаются только значения с теми же секундами что и значения части
+*/
+func (server *CurrencyServer) importBatch(ctx context.Context, pair string, batch []RatePoint, summary *ImportSummary) error {
+	// в истории время хранится с точностью до наносекунды, score - секунды
+	seconds := map[int64]*redis.StringSliceCmd{}
+	lookup := server.rdb(ctx).Pipeline()
+	for _, p := range batch {
+		sec := p.Time.Unix()
+		if _, ok := seconds[sec]; !ok {
+			score := strconv.FormatInt(sec, 10)
+			seconds[sec] = lookup.ZRangeByScore(historyKey(pair), redis.ZRangeBy{Min: score, Max: score})
+		}
+	}
+	if _, err := lookup.Exec(); err != nil {
+		return err
+	}
+	seen := map[int64]bool{}
+	for _, cmd := range seconds {
+		for _, m := range cmd.Val() {
+			if p, err := parseHistoryMember(m); err == nil {
+				seen[p.Time.UnixNano()] = true
+			}
+		}
+	}
+
+	pipe := server.rdb(ctx).Pipeline()
+	cutoff := server.historyCutoff()
+	added := 0
+	for _, p := range batch {
+		ns := p.Time.UnixNano()
+		// старше срока хранения - все равно будет удалено при записи
+		if seen[ns] || (!cutoff.IsZero() && p.Time.Before(cutoff)) {
+			summary.Skipped++
+			continue
+		}
+		seen[ns] = true
+		pipe.ZAdd(historyKey(pair), redis.Z{
+			Score:  float64(p.Time.Unix()),
+			Member: strconv.FormatInt(ns, 10) + ":" + p.Value.String(),
+		})
+		added++
+	}
+	if added == 0 {
+		return nil
+	}
+	if _, err := pipe.Exec(); err != nil {
+		return err
+	}
+	summary.Inserted += added
+	return nil
+}
+
+/*
+ImportCurrencyHistory
+POST /history/{type}/import (admin)
+тело запроса - CSV в формате выгрузки (time,pair,value) или time,value
+возвращает итог импорта, после импорта индикаторы пары пересчитываются
+*/
+func (server *CurrencyServer) ImportCurrencyHistory(w http.ResponseWriter, r *http.Request) {
+	logger := service.RequestLogger(r)
+	typeC := mux.Vars(r)["type"]
+	if !server.HasPair(typeC) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "Bad request incorrect type currency")
+		logger.Debugw("Not exist type of currency for import method", "err ", typeC)
+		return
+	}
+
+	summary, err := server.ImportHistory(r.Context(), r.Body, typeC)
+	if err != nil {
+		logger.Debugw("Can't import history", "pair", typeC, "err", err, "summary", summary.String())
+		// ошибка до первой строки данных - неверный заголовок файла
+		if summary.Read == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, "Bad request can't import history - "+err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, "Can't import history - "+summary.String())
+		return
+	}
+	logger.Infow("History imported", "actor", server.RequestActor(r, SourceAPI).Name, "summary", summary.String())
+	if summary.Inserted > 0 {
+		server.LoadPairIndicators(r.Context(), typeC)
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	json.NewEncoder(w).Encode(summary)
+}
@@ -0,0 +1,50 @@
+package libcurrency
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadHistoryCSV(t *testing.T) {
+	data := `time,pair,value
+2018-07-16T10:00:00Z,BTCUSD,6500.1
+2018-07-16T10:00:00.5Z,btcusd,6501
+1531738800,BTCUSD,6502
+2018-07-16T12:00:00Z,BTCEUR,5500
+yesterday,BTCUSD,6503
+2018-07-16T13:00:00Z,BTCUSD,-1
+2018-07-16T14:00:00Z,BTCUSD
+`
+	var points []RatePoint
+	summary := &ImportSummary{Pair: "BTCUSD"}
+	err := ReadHistoryCSV(strings.NewReader(data), "BTCUSD", summary, func(p RatePoint) error {
+		points = append(points, p)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 7, summary.Read)
+	assert.Equal(t, 4, summary.Invalid)
+	assert.Equal(t, 4, len(summary.Errors))
+	assert.Equal(t, "line 5: pair BTCEUR instead of BTCUSD", summary.Errors[0])
+	if assert.Equal(t, 3, len(points)) {
+		assert.Equal(t, "6500.1", points[0].Value.String())
+		assert.Equal(t, int64(500000000), points[1].Time.UnixNano()%1e9)
+		assert.Equal(t, int64(1531738800), points[2].Time.Unix())
+	}
+
+	// формат без колонки pair
+	points = nil
+	summary = &ImportSummary{Pair: "BTCUSD"}
+	err = ReadHistoryCSV(strings.NewReader("value,time\n6500.1,1531735200\n"), "BTCUSD", summary, func(p RatePoint) error {
+		points = append(points, p)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(points))
+
+	err = ReadHistoryCSV(strings.NewReader("date,rate\n"), "BTCUSD", &ImportSummary{}, func(p RatePoint) error { return nil })
+	assert.Error(t, err)
+}
@@ -0,0 +1,366 @@
+package libcurrency
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SArtemJ/CurrencyGameExample/currency/money"
+	"github.com/SArtemJ/CurrencyGameExample/currency/service"
+	"github.com/gorilla/mux"
+)
+
+const (
+	IndicatorSMA        = "sma"
+	IndicatorEMA        = "ema"
+	IndicatorVolatility = "volatility"
+)
+
+/*
+Indicators
+скользящие средние (SMA, EMA) и волатильность (стандартное отклонение логарифмических доходностей)
+по каждой паре для каждого окна из Windows
+окно - количество последних обновлений курса
+значения пересчитываются инкрементально при каждом сохранении курса (см. SaveRate),
+ведомые реплики добавляют новые значения из истории курсов (см. SyncIndicators)
+*/
+type Indicators struct {
+	Windows []int
+
+	m      sync.Mutex
+	series map[string]*indicatorSeries
+}
+
+type indicatorSeries struct {
+	last    money.Amount
+	updated time.Time
+	samples int
+	windows map[int]*indicatorWindow
+}
+
+type indicatorWindow struct {
+	size int
+
+	values []money.Amount
+	sum    money.Amount
+
+	ema money.Amount
+
+	returns []float64
+	rSum    float64
+	rSqSum  float64
+}
+
+/*
+IndicatorValue
+значение индикатора, Ready = false пока обновлений меньше чем размер окна
+*/
+type IndicatorValue struct {
+	Pair    string       `json:"pair"`
+	Kind    string       `json:"kind"`
+	Window  int          `json:"window"`
+	Value   money.Amount `json:"value"`
+	Samples int          `json:"samples"`
+	Ready   bool         `json:"ready"`
+}
+
+func NewIndicators(windows []int) *Indicators {
+	if len(windows) == 0 {
+		windows = []int{5, 20, 50}
+	}
+	return &Indicators{
+		Windows: windows,
+		series:  map[string]*indicatorSeries{},
+	}
+}
+
+/*
+ParseWindows
+разбирает список окон вида "5,20,50"
+*/
+func ParseWindows(value string) []int {
+	var windows []int
+	for _, v := range strings.Split(value, ",") {
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n > 1 {
+			windows = append(windows, n)
+		}
+	}
+	return windows
+}
+
+/*
+Reset
+удаляет все накопленные значения
+*/
+func (ind *Indicators) Reset() {
+	ind.m.Lock()
+	defer ind.m.Unlock()
+	ind.series = map[string]*indicatorSeries{}
+}
+
+/*
+Add
+добавляет новое значение курса пары, t - время значения в истории курса
+значение не новее последнего добавленного пропускается (уже учтено при пересчете по истории)
+*/
+func (ind *Indicators) Add(pair string, value money.Amount, t time.Time) {
+	if value.Sign() <= 0 {
+		return
+	}
+	ind.m.Lock()
+	defer ind.m.Unlock()
+
+	s, ok := ind.series[pair]
+	if !ok {
+		s = &indicatorSeries{windows: map[int]*indicatorWindow{}}
+		for _, n := range ind.Windows {
+			s.windows[n] = &indicatorWindow{size: n}
+		}
+		ind.series[pair] = s
+	} else if !t.After(s.updated) {
+		return
+	}
+
+	logReturn, hasReturn := 0.0, s.samples > 0
+	if hasReturn {
+		logReturn = math.Log(value.Float64() / s.last.Float64())
+	}
+	for _, w := range s.windows {
+		w.add(value, s.samples == 0, logReturn, hasReturn)
+	}
+	s.last = value
+	s.updated = t
+	s.samples++
+}
+
+/*
+Replace
+заменяет значения пары значениями из src (индикаторы пары пересчитанные отдельно)
+*/
+func (ind *Indicators) Replace(pair string, src *Indicators) {
+	src.m.Lock()
+	s, ok := src.series[pair]
+	src.m.Unlock()
+
+	ind.m.Lock()
+	defer ind.m.Unlock()
+	if ok {
+		ind.series[pair] = s
+	} else {
+		delete(ind.series, pair)
+	}
+}
+
+/*
+Updated
+время последнего добавленного значения пары, нулевое - значений нет
+*/
+func (ind *Indicators) Updated(pair string) time.Time {
+	ind.m.Lock()
+	defer ind.m.Unlock()
+	if s, ok := ind.series[pair]; ok {
+		return s.updated
+	}
+	return time.Time{}
+}
+
+func (w *indicatorWindow) add(value money.Amount, first bool, logReturn float64, hasReturn bool) {
+	w.values = append(w.values, value)
+	w.sum = w.sum.Add(value)
+	if len(w.values) > w.size {
+		w.sum = w.sum.Sub(w.values[0])
+		w.values = w.values[1:]
+	}
+
+	if first {
+		w.ema = value
+	} else {
+		alpha, _ := money.New(2, 0).Div(money.New(int64(w.size+1), 0))
+		w.ema = value.Sub(w.ema).Mul(alpha).Add(w.ema).RoundPlaces(12)
+	}
+
+	if hasReturn {
+		w.returns = append(w.returns, logReturn)
+		w.rSum += logReturn
+		w.rSqSum += logReturn * logReturn
+		if len(w.returns) > w.size {
+			old := w.returns[0]
+			w.rSum -= old
+			w.rSqSum -= old * old
+			w.returns = w.returns[1:]
+		}
+	}
+}
+
+/*
+Get
+значение индикатора kind для окна window
+*/
+func (ind *Indicators) Get(pair, kind string, window int) (IndicatorValue, bool) {
+	ind.m.Lock()
+	defer ind.m.Unlock()
+
+	result := IndicatorValue{Pair: pair, Kind: kind, Window: window}
+	if !ind.hasWindow(window) {
+		return result, false
+	}
+	if kind != IndicatorSMA && kind != IndicatorEMA && kind != IndicatorVolatility {
+		return result, false
+	}
+	s, ok := ind.series[pair]
+	if !ok {
+		return result, true
+	}
+	w := s.windows[window]
+
+	switch kind {
+	case IndicatorSMA:
+		result.Samples = len(w.values)
+		if mean, err := w.sum.Div(money.New(int64(len(w.values)), 0)); err == nil {
+			result.Value = mean.RoundPlaces(8)
+		}
+	case IndicatorEMA:
+		result.Samples = s.samples
+		result.Value = w.ema.RoundPlaces(8)
+	case IndicatorVolatility:
+		n := float64(len(w.returns))
+		result.Samples = len(w.returns)
+		if n > 1 {
+			// выборочная дисперсия
+			variance := (w.rSqSum - w.rSum*w.rSum/n) / (n - 1)
+			if variance < 0 {
+				variance = 0
+			}
+			result.Value = money.NewFromFloat(math.Sqrt(variance)).RoundPlaces(8)
+		}
+	}
+	result.Ready = result.Samples >= window
+	return result, true
+}
+
+func (ind *Indicators) hasWindow(window int) bool {
+	for _, n := range ind.Windows {
+		if n == window {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+LoadIndicators
+восстанавливает индикаторы по истории курсов после запуска сервера
+*/
+func (server *CurrencyServer) LoadIndicators() {
+	ctx, span := Tracer.Start(context.Background(), "load indicators")
+	defer span.End()
+	server.indicatorsM.Lock()
+	defer server.indicatorsM.Unlock()
+	server.Indicators.Reset()
+	for _, pair := range server.Pairs() {
+		server.loadPairIndicators(ctx, pair)
+	}
+}
+
+/*
+LoadPairIndicators
+пересчитывает индикаторы одной пары по истории курсов (после импорта истории)
+выполняется по очереди с обновлением курсов по тикеру
+*/
+func (server *CurrencyServer) LoadPairIndicators(ctx context.Context, pair string) {
+	ctx, span := Tracer.Start(ctx, "load pair indicators")
+	defer span.End()
+	server.indicatorsM.Lock()
+	defer server.indicatorsM.Unlock()
+	server.loadPairIndicators(ctx, pair)
+}
+
+/*
+loadPairIndicators
+история читается частями (см. ScanHistory), индикаторы пары заменяются целиком после чтения
+*/
+func (server *CurrencyServer) loadPairIndicators(ctx context.Context, pair string) {
+	fresh := NewIndicators(server.Indicators.Windows)
+	err := server.ScanHistory(ctx, pair, time.Time{}, time.Time{}, func(p RatePoint) error {
+		fresh.Add(pair, p.Value, p.Time)
+		return nil
+	})
+	if err != nil {
+		Logger.Debugw("Can't load history for indicators", "pair", pair, "err", err)
+		return
+	}
+	server.Indicators.Replace(pair, fresh)
+	// значения сохраненные пока читалась история
+	server.syncPairIndicators(ctx, pair)
+}
+
+/*
+SyncIndicators
+добавляет в индикаторы значения истории новее последнего добавленного
+курсы меняет ведущая реплика - ведомые вызывают SyncIndicators по тикеру
+*/
+func (server *CurrencyServer) SyncIndicators(ctx context.Context) {
+	for _, pair := range server.Pairs() {
+		server.syncPairIndicators(ctx, pair)
+	}
+}
+
+func (server *CurrencyServer) syncPairIndicators(ctx context.Context, pair string) {
+	since := server.Indicators.Updated(pair)
+	points, err := server.GetHistory(ctx, pair, since, time.Time{})
+	if err != nil {
+		Logger.Debugw("Can't load history for indicators", "pair", pair, "err", err)
+		return
+	}
+	for _, p := range points {
+		// GetHistory отдает значения с точностью до секунды - уже добавленные Add пропускает
+		server.Indicators.Add(pair, p.Value, p.Time)
+	}
+}
+
+/*
+GetIndicator
+kind - sma, ema, volatility
+window - размер окна (по умолчанию первое окно из настроек)
+*/
+func (server *CurrencyServer) GetIndicator(w http.ResponseWriter, r *http.Request) {
+	logger := service.RequestLogger(r)
+	typeC := mux.Vars(r)["type"]
+	if !server.HasPair(typeC) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "Bad request incorrect type currency")
+		logger.Debugw("Not exist type of currency for indicators method", "err ", typeC)
+		return
+	}
+
+	kind := r.FormValue("kind")
+	if kind == "" {
+		kind = IndicatorSMA
+	}
+	window := server.Indicators.Windows[0]
+	if v := r.FormValue("window"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, "Bad request incorrect window")
+			return
+		}
+		window = n
+	}
+
+	value, ok := server.Indicators.Get(typeC, kind, window)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "Bad request incorrect kind or window of indicator")
+		logger.Debugw("Not exist indicator", "kind", kind, "window", window)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,74 @@
+package libcurrency
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SArtemJ/CurrencyGameExample/currency/money"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndicators(t *testing.T) {
+	ind := NewIndicators([]int{3})
+	start := time.Date(2018, 7, 16, 10, 0, 0, 0, time.UTC)
+	for i, v := range []string{"100", "110", "121", "133.1"} {
+		ind.Add("BTCUSD", money.MustParse(v), start.Add(time.Duration(i)*time.Minute))
+	}
+	assert.Equal(t, start.Add(3*time.Minute), ind.Updated("BTCUSD"))
+	assert.True(t, ind.Updated("BTCEUR").IsZero())
+
+	sma, ok := ind.Get("BTCUSD", IndicatorSMA, 3)
+	assert.True(t, ok)
+	assert.True(t, sma.Ready)
+	assert.Equal(t, "121.36666667", sma.Value.String())
+
+	// alpha = 0.5: 100 -> 105 -> 113 -> 123.05
+	ema, _ := ind.Get("BTCUSD", IndicatorEMA, 3)
+	assert.Equal(t, "123.05", ema.Value.String())
+
+	// постоянный рост на 10% - доходности одинаковые, волатильность 0
+	vol, _ := ind.Get("BTCUSD", IndicatorVolatility, 3)
+	assert.Equal(t, 3, vol.Samples)
+	assert.True(t, vol.Value.IsZero())
+
+	// значение не новее последнего уже учтено
+	ind.Add("BTCUSD", money.MustParse("50"), start.Add(3*time.Minute))
+	sma, _ = ind.Get("BTCUSD", IndicatorSMA, 3)
+	assert.Equal(t, "121.36666667", sma.Value.String())
+
+	ind.Add("BTCUSD", money.MustParse("100"), start.Add(4*time.Minute))
+	vol, _ = ind.Get("BTCUSD", IndicatorVolatility, 3)
+	assert.False(t, vol.Value.IsZero())
+
+	_, ok = ind.Get("BTCUSD", IndicatorSMA, 7)
+	assert.False(t, ok)
+	_, ok = ind.Get("BTCUSD", "rsi", 3)
+	assert.False(t, ok)
+
+	empty, ok := ind.Get("BTCEUR", IndicatorSMA, 3)
+	assert.True(t, ok)
+	assert.False(t, empty.Ready)
+}
+
+func TestIndicatorsReplace(t *testing.T) {
+	ind := NewIndicators([]int{2})
+	start := time.Date(2018, 7, 16, 10, 0, 0, 0, time.UTC)
+	ind.Add("BTCUSD", money.MustParse("100"), start)
+	ind.Add("BTCEUR", money.MustParse("90"), start)
+
+	fresh := NewIndicators([]int{2})
+	fresh.Add("BTCUSD", money.MustParse("200"), start.Add(-time.Hour))
+	fresh.Add("BTCUSD", money.MustParse("100"), start)
+	ind.Replace("BTCUSD", fresh)
+	sma, _ := ind.Get("BTCUSD", IndicatorSMA, 2)
+	assert.Equal(t, "150", sma.Value.String())
+	sma, _ = ind.Get("BTCEUR", IndicatorSMA, 2)
+	assert.Equal(t, "90", sma.Value.String())
+
+	ind.Replace("BTCEUR", fresh)
+	assert.True(t, ind.Updated("BTCEUR").IsZero())
+}
+
+func TestParseWindows(t *testing.T) {
+	assert.Equal(t, []int{5, 20}, ParseWindows("5, 20,x,1"))
+}
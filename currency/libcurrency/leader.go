@@ -0,0 +1,204 @@
+package libcurrency
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+const (
+	LeaderKey        = "currency:leader"
+	DefaultLeaderTTL = time.Second * 15
+)
+
+// продление и снятие блокировки только если она принадлежит этой реплике
+var (
+	renewLeaderScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+	releaseLeaderScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+)
+
+/*
+Leader
+выбор ведущей реплики через блокировку в Redis (SET NX с временем жизни TTL)
+только ведущая реплика опрашивает внешние источники курсов, остальные только отдают данные
+ведущая реплика продлевает блокировку каждые TTL/3, если она перестала это делать
+(реплика упала или потеряла связь с Redis) - через TTL блокировку захватывает другая реплика
+*/
+type Leader struct {
+	ID  string
+	TTL time.Duration
+
+	m       sync.Mutex
+	client  *redis.Client
+	started bool
+	leader  bool
+	stop    chan struct{}
+	onElect func()
+}
+
+/*
+NewLeader
+id - идентификатор реплики (по умолчанию hostname-pid-случайное число)
+ttl - время жизни блокировки
+*/
+func NewLeader(id string, ttl time.Duration) *Leader {
+	if id == "" {
+		host, _ := os.Hostname()
+		id = fmt.Sprintf("%s-%d-%d", host, os.Getpid(), rand.New(rand.NewSource(time.Now().UnixNano())).Int63())
+	}
+	if ttl <= 0 {
+		ttl = DefaultLeaderTTL
+	}
+	return &Leader{ID: id, TTL: ttl}
+}
+
+/*
+Start
+запускает выборы в фоне
+onElect вызывается каждый раз когда реплика становится ведущей
+*/
+func (l *Leader) Start(client *redis.Client, onElect func()) {
+	l.m.Lock()
+	if l.started {
+		l.m.Unlock()
+		return
+	}
+	l.client = client
+	l.onElect = onElect
+	l.started = true
+	l.stop = make(chan struct{})
+	l.m.Unlock()
+
+	l.campaign()
+	go func() {
+		t := time.NewTicker(l.TTL / 3)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				l.campaign()
+			case <-l.stop:
+				return
+			}
+		}
+	}()
+}
+
+/*
+Stop
+останавливает выборы и освобождает блокировку если реплика ведущая
+*/
+func (l *Leader) Stop() {
+	l.m.Lock()
+	defer l.m.Unlock()
+	if !l.started {
+		return
+	}
+	close(l.stop)
+	l.started = false
+	if l.leader {
+		releaseLeaderScript.Run(l.client, []string{LeaderKey}, l.ID)
+		l.leader = false
+		Logger.Infow("Leadership released", "id", l.ID)
+	}
+}
+
+/*
+campaign
+захватывает свободную блокировку или продлевает свою
+*/
+func (l *Leader) campaign() {
+	l.m.Lock()
+	if !l.started {
+		l.m.Unlock()
+		return
+	}
+	was := l.leader
+	var err error
+	if was {
+		var renewed int64
+		renewed, err = renewLeaderScript.Run(l.client, []string{LeaderKey}, l.ID, int64(l.TTL/time.Millisecond)).Int64()
+		l.leader = err == nil && renewed == 1
+	} else {
+		l.leader, err = l.client.SetNX(LeaderKey, l.ID, l.TTL).Result()
+	}
+	if err != nil {
+		Logger.Debugw("Can't update leader lock in Redis", "id", l.ID, "err", err)
+		l.leader = false
+	}
+	elected := !was && l.leader
+	onElect := l.onElect
+	if was && !l.leader {
+		Logger.Infow("Leadership lost", "id", l.ID)
+	}
+	l.m.Unlock()
+
+	if elected {
+		Logger.Infow("Elected as leader", "id", l.ID)
+		if onElect != nil {
+			onElect()
+		}
+	}
+}
+
+/*
+IsLeader
+реплика ведущая и может опрашивать внешние источники
+*/
+func (l *Leader) IsLeader() bool {
+	l.m.Lock()
+	defer l.m.Unlock()
+	return l.leader
+}
+
+/*
+IsFollower
+выборы запущены и ведущая другая реплика
+(без запущенных выборов, например в cli командах, реплика работает как раньше)
+*/
+func (l *Leader) IsFollower() bool {
+	l.m.Lock()
+	defer l.m.Unlock()
+	return l.started && !l.leader
+}
+
+/*
+CurrentLeader
+идентификатор текущей ведущей реплики
+*/
+func (l *Leader) CurrentLeader(client *redis.Client) string {
+	id, _ := client.Get(LeaderKey).Result()
+	return id
+}
+
+/*
+LeaderOnly
+методы которые обращаются к внешним источникам курсов доступны только на ведущей реплике
+*/
+func (server *CurrencyServer) LeaderOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if server.Leader.IsFollower() {
+			if id := server.Leader.CurrentLeader(server.RClient); id != "" {
+				w.Header().Set("X-Leader", id)
+			}
+			w.WriteHeader(http.StatusServiceUnavailable)
+			io.WriteString(w, "This replica is not the leader - updates are disabled")
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,103 @@
+package libcurrency
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var (
+	CryptoAssets = []string{"BTC", "ETH", "LTC", "USDT"}
+	FiatAssets   = []string{"USD", "EUR", "GBP", "RUB"}
+
+	// CryptoPairs - курс каждой криптовалюты к каждой фиатной валюте (bitcoinaverage)
+	CryptoPairs = crossPairs(CryptoAssets, FiatAssets)
+	// FiatPairs - справочные курсы ECB, RUB в справочнике нет с марта 2022
+	FiatPairs = []string{"EURUSD", "EURGBP", "USDEUR", "USDGBP"}
+)
+
+func crossPairs(bases, quotes []string) []string {
+	var pairs []string
+	for _, b := range bases {
+		for _, q := range quotes {
+			pairs = append(pairs, b+q)
+		}
+	}
+	return pairs
+}
+
+func IsCrypto(code string) bool {
+	return inAssets(CryptoAssets, code)
+}
+
+func IsKnownAsset(code string) bool {
+	return IsCrypto(code) || inAssets(FiatAssets, code)
+}
+
+func inAssets(assets []string, code string) bool {
+	for _, v := range assets {
+		if v == code {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+SplitPair
+делит пару на базовую валюту и валюту котировки - BTCUSD -> BTC, USD; USDTRUB -> USDT, RUB
+коды валют могут быть разной длины, поэтому пара сверяется со списками известных валют
+*/
+func SplitPair(pair string) (string, string) {
+	for _, base := range append(append([]string{}, CryptoAssets...), FiatAssets...) {
+		if strings.HasPrefix(pair, base) && IsKnownAsset(pair[len(base):]) {
+			return base, pair[len(base):]
+		}
+	}
+	return "", ""
+}
+
+/*
+IsFiatPair
+пара из двух фиатных валют - курс берется из справочных курсов ECB
+*/
+func IsFiatPair(pair string) bool {
+	base, quote := SplitPair(pair)
+	return base != "" && !IsCrypto(base) && !IsCrypto(quote)
+}
+
+/*
+DefaultPairs
+все пары которые поддерживают источники курсов
+*/
+func DefaultPairs() []string {
+	return append(append([]string{}, CryptoPairs...), FiatPairs...)
+}
+
+/*
+ParsePairs
+разбирает список пар вида "BTCUSD,ETHUSD,EURUSD"
+пустой список - все пары по умолчанию, результат отсортирован
+пары с криптовалютой в котировке (ETHBTC) источники не поддерживают - используйте /convert
+*/
+func ParsePairs(value string) ([]string, error) {
+	var pairs []string
+	seen := map[string]bool{}
+	for _, v := range strings.Split(value, ",") {
+		pair := strings.ToUpper(strings.TrimSpace(v))
+		if pair == "" || seen[pair] {
+			continue
+		}
+		base, quote := SplitPair(pair)
+		if base == "" || base == quote || IsCrypto(quote) {
+			return nil, fmt.Errorf("unsupported pair %s", pair)
+		}
+		seen[pair] = true
+		pairs = append(pairs, pair)
+	}
+	if len(pairs) == 0 {
+		pairs = DefaultPairs()
+	}
+	sort.Strings(pairs)
+	return pairs, nil
+}
@@ -0,0 +1,234 @@
+package libcurrency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/SArtemJ/CurrencyGameExample/currency/money"
+	"github.com/SArtemJ/CurrencyGameExample/currency/service"
+	"github.com/go-redis/redis"
+	"github.com/gorilla/mux"
+)
+
+const (
+	PinKeyPrefix = "pin:"
+)
+
+var (
+	ErrPinned = errors.New("currency is pinned")
+)
+
+/*
+Pin
+зафиксированное вручную значение курса
+пока ключ pin:<pair> существует CurrencyUpdate и тикер не меняют курс пары
+Expires = nil - без ограничения по времени
+в meta:<pair> фиксация отмечается полем pinned - по нему ReleasePins находит истекшие фиксации
+*/
+type Pin struct {
+	Pair    string       `json:"pair"`
+	Value   money.Amount `json:"value"`
+	Expires *time.Time   `json:"expires,omitempty"`
+}
+
+func newPin(pair string, value money.Amount, ttl time.Duration) Pin {
+	pin := Pin{Pair: pair, Value: value}
+	if ttl > 0 {
+		expires := time.Now().Add(ttl).UTC().Truncate(time.Second)
+		pin.Expires = &expires
+	}
+	return pin
+}
+
+func pinKey(pair string) string {
+	return PinKeyPrefix + pair
+}
+
+/*
+unpinScript
+снимает отметку pinned с пары у которой больше нет ключа pin:<pair> и меняет версию курсов -
+клиенты с ETag/version получают курс без фиксации
+KEYS: pin:<pair>, meta:<pair>, rates:version; ARGV: время обновления (unix)
+*/
+var unpinScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 or redis.call("HDEL", KEYS[2], "pinned") == 0 then
+	return 0
+end
+redis.call("INCR", KEYS[3])
+redis.call("HINCRBY", KEYS[2], "version", 1)
+redis.call("HSET", KEYS[2], "updated", ARGV[1])
+return 1
+`)
+
+func (server *CurrencyServer) unpin(ctx context.Context, pair string) (bool, error) {
+	keys := []string{pinKey(pair), metaKey(pair), VersionKey}
+	n, err := unpinScript.Run(server.rdb(ctx), keys, time.Now().Unix()).Int64()
+	return n == 1, err
+}
+
+/*
+SetPin
+фиксирует значение курса пары на время ttl
+*/
+func (server *CurrencyServer) SetPin(ctx context.Context, pair string, value money.Amount, ttl time.Duration, actor Actor) error {
+	_, err := server.rdb(ctx).TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.Set(pinKey(pair), value.String(), ttl)
+		pipe.HSet(metaKey(pair), "pinned", 1)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := server.SaveRate(ctx, pair, value, actor, ProviderOverride); err != nil {
+		return err
+	}
+	Logger.Infow("Currency pinned", "pair", pair, "value", value.String(), "ttl", ttl.String())
+	return nil
+}
+
+/*
+DeletePin
+отменяет фиксацию курса пары, версия курсов меняется
+*/
+func (server *CurrencyServer) DeletePin(ctx context.Context, pair string) error {
+	if err := server.rdb(ctx).Del(pinKey(pair)).Err(); err != nil {
+		return err
+	}
+	_, err := server.unpin(ctx, pair)
+	return err
+}
+
+/*
+ReleasePins
+меняет версию курсов пар фиксация которых истекла (ключ pin:<pair> удален по ttl)
+вызывается тикером ведущей реплики
+*/
+func (server *CurrencyServer) ReleasePins(ctx context.Context) {
+	for _, pair := range server.Pairs() {
+		released, err := server.unpin(ctx, pair)
+		if err != nil {
+			Logger.Debugw("Can't release pin in Redis", "pair", pair, "err", err)
+			continue
+		}
+		if released {
+			Logger.Infow("Currency pin expired", "pair", pair)
+		}
+	}
+}
+
+/*
+GetPin
+возвращает активную фиксацию курса пары
+*/
+func (server *CurrencyServer) GetPin(ctx context.Context, pair string) (Pin, bool) {
+	str, err := server.rdb(ctx).Get(pinKey(pair)).Result()
+	if err != nil {
+		if err != redis.Nil {
+			Logger.Debugw("Can't get pin from Redis", "pair", pair, "err", err)
+		}
+		return Pin{Pair: pair}, false
+	}
+	value, err := money.Parse(str)
+	if err != nil {
+		return Pin{Pair: pair}, false
+	}
+	ttl, _ := server.rdb(ctx).TTL(pinKey(pair)).Result()
+	return newPin(pair, value, ttl), true
+}
+
+/*
+IsPinned
+пары из списка для которых действует фиксация курса
+*/
+func (server *CurrencyServer) IsPinned(ctx context.Context, pairs ...string) map[string]bool {
+	result := map[string]bool{}
+	keys := make([]string, len(pairs))
+	for i, p := range pairs {
+		keys[i] = pinKey(p)
+	}
+	values, err := server.rdb(ctx).MGet(keys...).Result()
+	if err != nil {
+		Logger.Debugw("Can't get pins from Redis", "err", err)
+		return result
+	}
+	for i, v := range values {
+		if v != nil {
+			result[pairs[i]] = true
+		}
+	}
+	return result
+}
+
+/*
+PinCurrency
+PUT /admin/pin/{type}
+value - значение курса
+ttl - время действия (30m, 24h, 7d), без ttl - до ручной отмены
+*/
+func (server *CurrencyServer) PinCurrency(w http.ResponseWriter, r *http.Request) {
+	logger := service.RequestLogger(r)
+	typeC := mux.Vars(r)["type"]
+	if !server.HasPair(typeC) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "Bad request incorrect type currency")
+		return
+	}
+	value, err := money.Parse(r.FormValue("value"))
+	if err != nil || value.Sign() <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "Bad request incorrect value")
+		return
+	}
+	var ttl time.Duration
+	if v := r.FormValue("ttl"); v != "" {
+		if ttl, err = ParseSince(v); err != nil || ttl <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, "Bad request incorrect ttl")
+			return
+		}
+	}
+
+	if err := server.SetPin(r.Context(), typeC, value, ttl, server.RequestActor(r, SourceOverride)); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, "Can't save pin to Redis")
+		logger.Debugw("Can't save pin to Redis", "err", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	json.NewEncoder(w).Encode(newPin(typeC, value, ttl))
+}
+
+/*
+UnpinCurrency
+DELETE /admin/pin/{type} - курс снова обновляется из внешних источников
+*/
+func (server *CurrencyServer) UnpinCurrency(w http.ResponseWriter, r *http.Request) {
+	logger := service.RequestLogger(r)
+	typeC := mux.Vars(r)["type"]
+	if err := server.DeletePin(r.Context(), typeC); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, "Can't delete pin from Redis")
+		return
+	}
+	logger.Infow("Currency unpinned", "pair", typeC)
+	io.WriteString(w, "Pin removed "+typeC)
+}
+
+/*
+GetPins
+GET /admin/pins - все активные фиксации курсов
+*/
+func (server *CurrencyServer) GetPins(w http.ResponseWriter, r *http.Request) {
+	pins := []Pin{}
+	for _, pair := range server.Pairs() {
+		if pin, ok := server.GetPin(r.Context(), pair); ok {
+			pins = append(pins, pin)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	json.NewEncoder(w).Encode(pins)
+}
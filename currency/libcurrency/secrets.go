@@ -0,0 +1,137 @@
+package libcurrency
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SArtemJ/CurrencyGameExample/currency/service"
+)
+
+var (
+	ErrNoCredentials = errors.New("bitcoinaverage credentials are not configured")
+)
+
+/*
+Secret
+секрет из файла (docker/kubernetes secrets) или переменной окружения
+File имеет приоритет, файл перечитывается при изменении - ротация без перезапуска
+значение никогда не выводится в логи и ответы (String, MarshalJSON - [REDACTED])
+*/
+type Secret struct {
+	Env  string
+	File string
+
+	m       sync.Mutex
+	value   string
+	modTime time.Time
+	size    int64
+}
+
+func NewSecret(env, file string) *Secret {
+	return &Secret{Env: env, File: file}
+}
+
+/*
+Value
+текущее значение секрета
+*/
+func (s *Secret) Value() (string, error) {
+	if s == nil {
+		return "", nil
+	}
+	if s.File == "" {
+		return strings.TrimSpace(os.Getenv(s.Env)), nil
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	info, err := os.Stat(s.File)
+	if err != nil {
+		return "", fmt.Errorf("can't read secret file %s: %v", s.File, err)
+	}
+	if info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return s.value, nil
+	}
+	data, err := ioutil.ReadFile(s.File)
+	if err != nil {
+		return "", fmt.Errorf("can't read secret file %s: %v", s.File, err)
+	}
+	if !s.modTime.IsZero() {
+		Logger.Infow("Secret file changed - reloaded", "file", s.File)
+	}
+	s.value = strings.TrimSpace(string(data))
+	s.modTime = info.ModTime()
+	s.size = info.Size()
+	return s.value, nil
+}
+
+func (s *Secret) String() string {
+	return service.Redacted
+}
+
+func (s *Secret) GoString() string {
+	return service.Redacted
+}
+
+func (s *Secret) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + service.Redacted + `"`), nil
+}
+
+/*
+Credentials
+ключи bitcoinaverage
+*/
+type Credentials struct {
+	Public *Secret
+	Secret *Secret
+}
+
+/*
+NewCredentials
+envPrefix - префикс переменных окружения (CURRENCY):
+CURRENCY_PUB_KEY, CURRENCY_SECRET_KEY - значения ключей
+pubFile, secretFile - файлы с ключами (pub.key_file, secret.key_file)
+*/
+func NewCredentials(envPrefix, pubFile, secretFile string) *Credentials {
+	prefix := strings.ToUpper(envPrefix) + "_"
+	return &Credentials{
+		Public: NewSecret(prefix+"PUB_KEY", pubFile),
+		Secret: NewSecret(prefix+"SECRET_KEY", secretFile),
+	}
+}
+
+/*
+Keys
+текущие значения ключей, ErrNoCredentials - если хотя бы один не задан
+*/
+func (c *Credentials) Keys() (string, string, error) {
+	if c == nil {
+		return "", "", ErrNoCredentials
+	}
+	pub, err := c.Public.Value()
+	if err != nil {
+		return "", "", err
+	}
+	secret, err := c.Secret.Value()
+	if err != nil {
+		return "", "", err
+	}
+	if pub == "" || secret == "" {
+		return "", "", ErrNoCredentials
+	}
+	return pub, secret, nil
+}
+
+/*
+CheckCredentials
+сервер не запускается без ключей bitcoinaverage
+*/
+func (server *CurrencyServer) CheckCredentials() error {
+	_, _, err := server.Credentials.Keys()
+	return err
+}
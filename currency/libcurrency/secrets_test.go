@@ -0,0 +1,70 @@
+package libcurrency
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/SArtemJ/CurrencyGameExample/currency/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCredentialsFromEnv(t *testing.T) {
+	c := NewCredentials("currency_secret_test", "", "")
+	_, _, err := c.Keys()
+	assert.Equal(t, ErrNoCredentials, err)
+
+	os.Setenv("CURRENCY_SECRET_TEST_PUB_KEY", "pub")
+	os.Setenv("CURRENCY_SECRET_TEST_SECRET_KEY", " secret\n")
+	defer os.Unsetenv("CURRENCY_SECRET_TEST_PUB_KEY")
+	defer os.Unsetenv("CURRENCY_SECRET_TEST_SECRET_KEY")
+
+	pub, secret, err := c.Keys()
+	require.NoError(t, err)
+	assert.Equal(t, "pub", pub)
+	assert.Equal(t, "secret", secret)
+}
+
+func TestCredentialsFileRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	pubFile := filepath.Join(dir, "pub")
+	secretFile := filepath.Join(dir, "secret")
+	require.NoError(t, ioutil.WriteFile(pubFile, []byte("pub1\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(secretFile, []byte("secret1\n"), 0600))
+
+	c := NewCredentials("currency_secret_test", pubFile, secretFile)
+	pub, secret, err := c.Keys()
+	require.NoError(t, err)
+	assert.Equal(t, "pub1", pub)
+	assert.Equal(t, "secret1", secret)
+
+	require.NoError(t, ioutil.WriteFile(secretFile, []byte("secret22\n"), 0600))
+	later := time.Now().Add(time.Second)
+	require.NoError(t, os.Chtimes(secretFile, later, later))
+	_, secret, err = c.Keys()
+	require.NoError(t, err)
+	assert.Equal(t, "secret22", secret)
+
+	os.Remove(pubFile)
+	_, _, err = c.Keys()
+	assert.Error(t, err)
+}
+
+func TestSecretRedacted(t *testing.T) {
+	os.Setenv("CURRENCY_SECRET_TEST_PUB_KEY", "pub")
+	defer os.Unsetenv("CURRENCY_SECRET_TEST_PUB_KEY")
+	c := NewCredentials("currency_secret_test", "", "")
+
+	assert.Equal(t, service.Redacted, fmt.Sprint(c.Public))
+	assert.Equal(t, service.Redacted, fmt.Sprintf("%#v", c.Public))
+	data, err := json.Marshal(c)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), `"pub"`)
+}
@@ -1,42 +1,118 @@
 package libcurrency
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
+	"net"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/SArtemJ/CurrencyGameExample/currency/money"
+	"github.com/SArtemJ/CurrencyGameExample/currency/service"
 	"github.com/go-redis/redis"
 	"github.com/gorilla/mux"
 	"github.com/nicovogelaar/go-bitcoinaverage/bitcoinaverage"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type CurrencyServer struct {
 	Address   string
 	APIPrefix string
-	PublicKey string
-	SecretKey string
+	RedisAddr string
+
+	Credentials *Credentials
+
+	AdminToken string
 
 	Ticker  *time.Ticker
 	Router  *mux.Router
 	RClient *redis.Client
+	ECB     *ECBProvider
+	Leader  *Leader
+	Updates *Coalescer
+	Guard   *RateGuard
+	Proxies *TrustedProxies
+
+	Indicators *Indicators
+	Currencies *CurrencyCatalog
+	// тикер и пересчет индикаторов пары после импорта истории выполняются по очереди
+	indicatorsM sync.Mutex
+
+	Currency  map[string]money.Amount
+	currencyM sync.RWMutex
 
-	Currency map[string]float64
+	Config       *service.ActiveConfig
+	tickerPeriod time.Duration
+	tickerReset  chan time.Duration
+
+	statsM sync.Mutex
+	stats  map[string]RateStats
+
+	// срок хранения истории в наносекундах (см. SetHistoryRetention)
+	historyRetention int64
 }
 
 type CurrencyServerConfig struct {
 	address   string
 	apiPrefix string
 	ticker    int64
-	publicKey string
-	secretKey string
+	ecbSource string
+	// ecbTimeout - таймаут запроса справочных курсов ECB
+	ecbTimeout time.Duration
+	redisAddr  string
+	windows    []int
+
+	adminToken     string
+	trustedProxies []*net.IPNet
+	leaderID       string
+	leaderTTL      time.Duration
+	minRefresh     time.Duration
+
+	historyRetention   time.Duration
+	guardDeviation     float64
+	guardConfirmations int
+
+	credentials *Credentials
+	pairs       []string
+	currencies  map[string]CurrencyOverride
 }
 
 type ReturnCurrency struct {
-	Value float64 `json:"value"`
+	Value      money.Amount `json:"value"`
+	Overridden bool         `json:"overridden,omitempty"`
+}
+
+/*
+ReturnAll
+курсы всех пар, Overridden - пары курс которых зафиксирован вручную
+*/
+type ReturnAll struct {
+	Rates      map[string]money.Amount `json:"rates"`
+	Overridden []string                `json:"overridden,omitempty"`
+}
+
+/*
+ReturnSnapshot
+курсы нескольких пар прочитанные из Redis одной операцией
+Version - номер версии курсов, увеличивается при каждом обновлении любой пары
+*/
+type ReturnSnapshot struct {
+	Version    int64                   `json:"version"`
+	Rates      map[string]money.Amount `json:"rates"`
+	Overridden []string                `json:"overridden,omitempty"`
 }
 
+const (
+	VersionKey = "rates:version"
+)
+
 func NewServer(cfg CurrencyServerConfig) *CurrencyServer {
 	if cfg.address == "" {
 		cfg.address = "0.0.0.0:8888"
@@ -47,21 +123,38 @@ func NewServer(cfg CurrencyServerConfig) *CurrencyServer {
 	if cfg.ticker == 0 {
 		cfg.ticker = 1
 	}
-	if cfg.publicKey == "" {
-		cfg.publicKey = "ODkzOGI3NTk3ODk1NGVmMDgzMDRiMWZkYTJiZDQzOTg"
-	}
-	if cfg.secretKey == "" {
-		cfg.secretKey = "NTNlNDc2M2Y2ODJhNDViYmFlMjM5NGJmNDk2MTAxZDQwZGUyZWYxZTFmOTA0MTRjYWJkMGRmNTdiNTAzN2I4MQ"
+	if cfg.redisAddr == "" {
+		cfg.redisAddr = "redis:6379"
 	}
 
 	server := &CurrencyServer{
 		Address:   cfg.address,
 		APIPrefix: cfg.apiPrefix,
-		PublicKey: cfg.publicKey,
-		SecretKey: cfg.secretKey,
+		RedisAddr: cfg.redisAddr,
 		Ticker:    time.NewTicker(time.Minute * time.Duration(cfg.ticker)),
 		Router:    mux.NewRouter(),
-		Currency:  map[string]float64{"BTCUSD": 0.00, "BTCEUR": 0.00, "BTCGBP": 0.00, "BTCRUB": 0.00},
+		ECB:       NewECBProvider(cfg.ecbSource, cfg.ecbTimeout),
+		Leader:    NewLeader(cfg.leaderID, cfg.leaderTTL),
+		Updates:   NewCoalescer(cfg.minRefresh),
+		Guard:     NewRateGuard(cfg.guardDeviation, cfg.guardConfirmations),
+		Proxies:   NewTrustedProxies(cfg.trustedProxies),
+		Currency:  map[string]money.Amount{},
+		stats:     map[string]RateStats{},
+
+		AdminToken:  cfg.adminToken,
+		Credentials: cfg.credentials,
+	}
+	server.SetHistoryRetention(cfg.historyRetention)
+	server.Indicators = NewIndicators(cfg.windows)
+	server.Currencies = NewCurrencyCatalog(cfg.currencies)
+	server.Config = &service.ActiveConfig{}
+	server.tickerPeriod = time.Minute * time.Duration(cfg.ticker)
+	server.tickerReset = make(chan time.Duration, 1)
+	if len(cfg.pairs) == 0 {
+		cfg.pairs = DefaultPairs()
+	}
+	for _, v := range cfg.pairs {
+		server.Currency[v] = money.Zero
 	}
 
 	server.SetupRouter()
@@ -75,128 +168,505 @@ func (server *CurrencyServer) GetRouter() *mux.Router {
 func (server *CurrencyServer) SetupRouter() {
 	server.Router = server.Router.PathPrefix(server.APIPrefix).Subrouter()
 	Logger.Debugf(`API endpoint "%s"`, server.APIPrefix)
+	server.Router.Use(service.TraceHTTP(ServiceName), service.AccessLog)
 
-	server.Router.HandleFunc("/update/{type}", server.UpdateOneCurrency).Methods("PATCH")
+	server.Router.HandleFunc("/update/{type}", server.LeaderOnly(server.UpdateOneCurrency)).Methods("PATCH")
 	server.Router.HandleFunc("/currency/{type}", server.GetOneCurrency).Methods("GET")
+	server.Router.HandleFunc("/currency", server.GetSnapshotCurrency).Methods("GET")
 	server.Router.HandleFunc("/currencyall", server.GetAllCurrency).Methods("GET")
-	server.Router.HandleFunc("/updateall", server.UpdateAllCurrency).Methods("PATCH")
+	server.Router.HandleFunc("/updateall", server.LeaderOnly(server.UpdateAllCurrency)).Methods("PATCH")
+	server.Router.HandleFunc("/history/{type}", server.GetCurrencyHistory).Methods("GET")
+	server.Router.HandleFunc("/history/{type}/export", server.ExportCurrencyHistory).Methods("GET")
+	server.Router.HandleFunc("/history/{type}/import", server.AdminOnly(server.ImportCurrencyHistory)).Methods("POST")
+	server.Router.HandleFunc("/stats/{type}", server.GetOneStats).Methods("GET")
+	server.Router.HandleFunc("/stats", server.GetAllStats).Methods("GET")
+	server.Router.HandleFunc("/indicators/{type}", server.GetIndicator).Methods("GET")
+	server.Router.HandleFunc("/convert", server.ConvertCurrency).Methods("GET")
+	server.Router.HandleFunc("/currencies", server.GetCurrencies).Methods("GET")
+
+	server.Router.HandleFunc("/admin/pin/{type}", server.AdminOnly(server.PinCurrency)).Methods("PUT")
+	server.Router.HandleFunc("/admin/pin/{type}", server.AdminOnly(server.UnpinCurrency)).Methods("DELETE")
+	server.Router.HandleFunc("/admin/pins", server.AdminOnly(server.GetPins)).Methods("GET")
+	server.Router.HandleFunc("/audit", server.AdminOnly(server.GetAudit)).Methods("GET")
+	server.Router.HandleFunc("/admin/quarantine", server.AdminOnly(server.GetQuarantine)).Methods("GET")
+	server.Router.HandleFunc("/admin/config", server.AdminOnly(server.GetConfig)).Methods("GET")
 }
 
 func (server *CurrencyServer) Run() {
 	server.RedisConnection()
-	go func() {
-		for t := range server.Ticker.C {
-			server.DoUpdateImmediately()
-			Logger.Debugf(`Last update all currency "%s"`, t)
-		}
-	}()
+	server.LoadIndicators()
+	// новая ведущая реплика пересчитывает индикаторы - пока она была ведомой курсы меняла другая реплика
+	server.Leader.Start(server.RClient, server.LoadIndicators)
+	go server.runTicker()
 	Logger.Debugf(`Stream server started on "%s"`, server.Address)
 	http.ListenAndServe(server.Address, server.Router)
 }
 
+/*
+runTicker
+периодическое обновление всех курсов на ведущей реплике,
+на ведомых - индикаторы по новым значениям истории
+период меняется без перезапуска через SetTickerPeriod
+*/
+func (server *CurrencyServer) runTicker() {
+	for {
+		select {
+		case t := <-server.Ticker.C:
+			if !server.Leader.IsLeader() {
+				// курсы меняет ведущая реплика - индикаторы догоняют историю
+				ctx, span := Tracer.Start(context.Background(), "sync indicators")
+				server.indicatorsM.Lock()
+				server.SyncIndicators(ctx)
+				server.indicatorsM.Unlock()
+				span.End()
+				continue
+			}
+			ctx, span := Tracer.Start(context.Background(), "ticker update")
+			server.indicatorsM.Lock()
+			server.ReleasePins(ctx)
+			server.DoUpdateImmediately(ctx, TickerActor)
+			server.indicatorsM.Unlock()
+			span.End()
+			Logger.Debugf(`Last update all currency "%s"`, t)
+		case d := <-server.tickerReset:
+			server.Ticker.Stop()
+			server.Ticker = time.NewTicker(d)
+			Logger.Infow("Ticker period changed", "period", d.String())
+		}
+	}
+}
+
+/*
+SetTickerPeriod
+новый период обновления курсов, применяется запущенным тикером
+*/
+func (server *CurrencyServer) SetTickerPeriod(d time.Duration) {
+	if d <= 0 || d == server.tickerPeriod {
+		return
+	}
+	server.tickerPeriod = d
+	select {
+	case <-server.tickerReset:
+	default:
+	}
+	server.tickerReset <- d
+}
+
+/*
+HasPair
+пара есть в списке обслуживаемых
+*/
+func (server *CurrencyServer) HasPair(pair string) bool {
+	server.currencyM.RLock()
+	defer server.currencyM.RUnlock()
+	_, ok := server.Currency[pair]
+	return ok
+}
+
+/*
+Pairs
+список обслуживаемых пар
+*/
+func (server *CurrencyServer) Pairs() []string {
+	server.currencyM.RLock()
+	defer server.currencyM.RUnlock()
+	pairs := make([]string, 0, len(server.Currency))
+	for i := range server.Currency {
+		pairs = append(pairs, i)
+	}
+	sort.Strings(pairs)
+	return pairs
+}
+
+/*
+SetPairs
+меняет список обслуживаемых пар без перезапуска
+история и значения убранных пар остаются в Redis
+*/
+func (server *CurrencyServer) SetPairs(pairs []string) {
+	currency := make(map[string]money.Amount, len(pairs))
+	for _, v := range pairs {
+		currency[v] = money.Zero
+	}
+	server.currencyM.Lock()
+	server.Currency = currency
+	server.currencyM.Unlock()
+
+	if server.RClient != nil {
+		for _, v := range pairs {
+			server.RClient.SetNX(v, money.Zero.String(), 0)
+		}
+	}
+	Logger.Infow("Currency pairs changed", "pairs", strings.Join(pairs, ","))
+}
+
+/*
+UpdateOneCurrency
+PATCH /update/{type} - обновляет курс пары из внешнего источника
+курс зафиксированной пары не меняется - 409 с текущим значением
+*/
 func (server *CurrencyServer) UpdateOneCurrency(w http.ResponseWriter, r *http.Request) {
+	logger := service.RequestLogger(r)
 	typeC := mux.Vars(r)["type"]
-	if _, ok := server.Currency[typeC]; ok {
-		if done := server.CurrencyUpdate(typeC); done == true {
+	if server.HasPair(typeC) {
+		done := server.CurrencyUpdate(r.Context(), typeC, server.RequestActor(r, SourceAPI))
+		if pin, ok := server.GetPin(r.Context(), typeC); ok {
+			w.WriteHeader(http.StatusConflict)
+			io.WriteString(w, "Value currency is pinned "+typeC+" = "+pin.Value.String())
+			logger.Debugw("Currency is pinned - not updated", "pair", typeC)
+			return
+		}
+		if done == true {
 			w.WriteHeader(http.StatusOK)
 			resStr := "Value currency was updated " + typeC +
-				" = " + strconv.FormatFloat(server.GetRValue(typeC), 'f', -1, 64)
+				" = " + server.GetRValue(r.Context(), typeC).String()
 			io.WriteString(w, resStr)
 		}
 	} else {
 		w.WriteHeader(http.StatusBadRequest)
 		io.WriteString(w, "Not exist type of currency or server bitcoinaverage - return error")
-		Logger.Debugw("Not exist type of currency for update - or server bitcoinaverage - return error", "err ", typeC)
+		logger.Debugw("Not exist type of currency for update - or server bitcoinaverage - return error", "err ", typeC)
 	}
 }
 
 func (server *CurrencyServer) GetOneCurrency(w http.ResponseWriter, r *http.Request) {
+	logger := service.RequestLogger(r)
 	var resultC ReturnCurrency
 	typeC := mux.Vars(r)["type"]
-	if _, ok := server.Currency[typeC]; ok {
-		resultC.Value = server.GetRValue(typeC)
+	if server.HasPair(typeC) {
+		metas, err := server.GetRMeta(r.Context(), typeC)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, "Can't get value from Redis")
+			logger.Debugw("Can't get value from Redis", "err", err)
+			return
+		}
+		if CheckNotModified(w, r, RatesETag(metas), metas[typeC].Updated) {
+			return
+		}
+		resultC.Value = metas[typeC].Value
+		resultC.Overridden = metas[typeC].Pinned
 		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 		json.NewEncoder(w).Encode(resultC)
 		w.WriteHeader(http.StatusOK)
 	} else {
 		w.WriteHeader(http.StatusBadRequest)
 		io.WriteString(w, "Bad request incorrect type currency")
-		Logger.Debugw("Not exist type of currency for get method", "err ", typeC)
+		logger.Debugw("Not exist type of currency for get method", "err ", typeC)
 		return
 	}
 }
 
+/*
+GetSnapshotCurrency
+курсы нескольких пар из одного обновления
+types - список пар через запятую (BTCUSD,BTCEUR)
+*/
+func (server *CurrencyServer) GetSnapshotCurrency(w http.ResponseWriter, r *http.Request) {
+	logger := service.RequestLogger(r)
+	types := strings.Split(r.FormValue("types"), ",")
+	for _, v := range types {
+		if !server.HasPair(v) {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, "Bad request incorrect type currency "+v)
+			logger.Debugw("Not exist type of currency for snapshot method", "err ", v)
+			return
+		}
+	}
+
+	snapshot, err := server.GetRSnapshot(r.Context(), types)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, "Can't get values from Redis")
+		logger.Debugw("Can't get snapshot from Redis", "err", err)
+		return
+	}
+	pinned := server.IsPinned(r.Context(), types...)
+	for _, v := range types {
+		if pinned[v] {
+			snapshot.Overridden = append(snapshot.Overridden, v)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	json.NewEncoder(w).Encode(snapshot)
+}
+
 func (server *CurrencyServer) UpdateAllCurrency(w http.ResponseWriter, r *http.Request) {
-	server.DoUpdateImmediately()
+	logger := service.RequestLogger(r)
+	server.DoUpdateImmediately(r.Context(), server.RequestActor(r, SourceAPI))
 	w.WriteHeader(http.StatusOK)
 	io.WriteString(w, "All currency was updated")
-	Logger.Debugw("All currency was updated")
+	logger.Debugw("All currency was updated")
 }
 
 func (server *CurrencyServer) GetAllCurrency(w http.ResponseWriter, r *http.Request) {
+	logger := service.RequestLogger(r)
+	keys := server.Pairs()
+	metas, err := server.GetRMeta(r.Context(), keys...)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, "Can't get values from Redis")
+		logger.Debugw("Can't get values from Redis", "err", err)
+		return
+	}
+	if CheckNotModified(w, r, RatesETag(metas), RatesLastModified(metas)) {
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	allCurrency := map[string]float64{}
-	for i, _ := range server.Currency {
-		allCurrency[i] = server.GetRValue(i)
+	allCurrency := ReturnAll{Rates: map[string]money.Amount{}}
+	for i, m := range metas {
+		allCurrency.Rates[i] = m.Value
+		if m.Pinned {
+			allCurrency.Overridden = append(allCurrency.Overridden, i)
+		}
+	}
+	if len(allCurrency.Overridden) > 0 {
+		sort.Strings(allCurrency.Overridden)
+		w.Header().Set("X-Rate-Overridden", strings.Join(allCurrency.Overridden, ","))
 	}
 	json.NewEncoder(w).Encode(allCurrency)
 	w.WriteHeader(http.StatusOK)
 }
 
-func (server *CurrencyServer) DoUpdateImmediately() {
-	for i, _ := range server.Currency {
-		server.CurrencyUpdate(i)
+/*
+GetCurrencyHistory
+история курса пары
+since - период от текущего момента (24h, 7d)
+from, to - границы периода (RFC3339 или unix время)
+*/
+func (server *CurrencyServer) GetCurrencyHistory(w http.ResponseWriter, r *http.Request) {
+	logger := service.RequestLogger(r)
+	typeC := mux.Vars(r)["type"]
+	if !server.HasPair(typeC) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "Bad request incorrect type currency")
+		logger.Debugw("Not exist type of currency for history method", "err ", typeC)
+		return
+	}
+
+	from, to, err := ParsePeriod(r.FormValue("since"), r.FormValue("from"), r.FormValue("to"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "Bad request incorrect period - "+err.Error())
+		return
+	}
+
+	points, err := server.GetHistory(r.Context(), typeC, from, to)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, "Can't get history from Redis")
+		logger.Debugw("Can't get history from Redis", "err", err)
+		return
 	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	json.NewEncoder(w).Encode(points)
 }
 
-func (server *CurrencyServer) CurrencyUpdate(v string) bool {
-	btcClient := bitcoinaverage.NewClient(server.PublicKey, server.SecretKey)
+func (server *CurrencyServer) DoUpdateImmediately(ctx context.Context, actor Actor) {
+	for _, i := range server.Pairs() {
+		server.CurrencyUpdate(ctx, i, actor)
+	}
+}
+
+/*
+CurrencyUpdate
+обновляет курс пары из внешнего источника
+actor - кто запросил обновление (для журнала изменений)
+одновременные обновления одной пары выполняют один запрос к источнику,
+если курс обновлялся раньше чем update.min_interval назад - остается текущее значение
+*/
+func (server *CurrencyServer) CurrencyUpdate(ctx context.Context, v string, actor Actor) bool {
+	ok, fresh := server.Updates.Do(ctx, v, func(ctx context.Context) bool {
+		return server.fetchCurrency(ctx, v, actor)
+	})
+	if fresh {
+		Logger.Debugw("Currency was updated recently - skip update", "pair", v)
+	}
+	return ok
+}
+
+func (server *CurrencyServer) fetchCurrency(ctx context.Context, v string, actor Actor) bool {
+	if _, ok := server.GetPin(ctx, v); ok {
+		Logger.Debugw("Currency is pinned - skip update", "pair", v)
+		return true
+	}
+	if IsFiatPair(v) {
+		return server.FiatCurrencyUpdate(ctx, v, actor)
+	}
+	publicKey, secretKey, err := server.Credentials.Keys()
+	if err != nil {
+		Logger.Errorw("Can't get bitcoinaverage credentials", "err", err)
+		return false
+	}
+	btcClient := bitcoinaverage.NewClient(publicKey, secretKey)
 	btcDataService := bitcoinaverage.NewPriceDataService(btcClient)
+	_, span := Tracer.Start(ctx, "bitcoinaverage ticker", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("pair", v)))
 	btcData, err := btcDataService.GetTickerDataBySymbol(bitcoinaverage.SymbolSetGlobal, v)
+	service.EndSpan(span, err)
 	if err != nil {
 		Logger.Debugw("No currency data to save or bad request to bitcoinaverage")
 		return false
 	} else {
-		server.SetRValue(v, btcData.Ask)
-		return true
+		return server.GuardRate(ctx, v, money.NewFromFloat(btcData.Ask), actor, ProviderBitcoinAverage)
 	}
 }
 
+/*
+FiatCurrencyUpdate
+обновляет курс фиатной пары (EURUSD, USDGBP...) по справочным курсам ECB
+пары с валютой, которой нет в справочнике, пропускаются с предупреждением
+*/
+func (server *CurrencyServer) FiatCurrencyUpdate(ctx context.Context, v string, actor Actor) bool {
+	base, quote := SplitPair(v)
+	_, span := Tracer.Start(ctx, "ecb rate", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("pair", v)))
+	rate, err := server.ECB.Rate(ctx, base, quote)
+	service.EndSpan(span, err)
+	if errors.Is(err, ErrNoReferenceRate) {
+		Logger.Warnw("ECB feed has no reference rate for pair, skipped", "pair", v, "err", err)
+		return false
+	}
+	if err != nil {
+		Logger.Debugw("No currency data to save or bad request to ECB", "pair", v, "err", err)
+		return false
+	}
+	return server.GuardRate(ctx, v, rate, actor, ProviderECB)
+}
+
 //redis
-func (server *CurrencyServer) RedisConnection() {
+/*
+RedisConnect
+только подключение к Redis - без инициализации значений (используется командами cli)
+*/
+func (server *CurrencyServer) RedisConnect() bool {
 	server.RClient = redis.NewClient(&redis.Options{
-		//Addr: "localhost:6379", //для локальной машины
-		Addr:     "redis:6379", //для  docker
+		//localhost:6379 - для локальной машины
+		//redis:6379 - для docker
+		Addr:     server.RedisAddr,
 		Password: "",
 		DB:       0,
 	})
 
 	_, err := server.RClient.Ping().Result()
 	if err != nil {
-		Logger.Debugw("No connection to Redis")
+		Logger.Debugw("No connection to Redis", "addr", server.RedisAddr)
+		return false
+	}
+	return true
+}
+
+/*
+RedisConnection
+подключение к Redis и инициализация пар которых еще нет в базе
+история и последние значения курсов сохраняются между перезапусками
+*/
+func (server *CurrencyServer) RedisConnection() {
+	if !server.RedisConnect() {
 		return
 	}
 
-	server.RClient.FlushAll()
-	for i, v := range server.Currency {
-		server.SetRValue(i, v)
+	for _, i := range server.Pairs() {
+		server.RClient.SetNX(i, money.Zero.String(), 0)
 	}
 	Logger.Debugw("Redis connection - ok")
 }
 
-func (server *CurrencyServer) SetRValue(key string, value float64) {
-	err := server.RClient.Set(key, value, 0).Err()
+/*
+saveRateScript
+запись курса одной командой: значение, номер версии курсов и метаданные пары (meta:)
+если ARGV[3] = 1 и пара зафиксирована (pin:<pair>) - ничего не меняет и возвращает {0}
+KEYS: пара, rates:version, meta:<pair>, pin:<pair>; ARGV: значение, время обновления (unix), проверять фиксацию
+*/
+var saveRateScript = redis.NewScript(`
+if ARGV[3] == "1" and redis.call("EXISTS", KEYS[4]) == 1 then
+	return {0}
+end
+local old = redis.call("GETSET", KEYS[1], ARGV[1])
+redis.call("INCR", KEYS[2])
+redis.call("HINCRBY", KEYS[3], "version", 1)
+redis.call("HSET", KEYS[3], "updated", ARGV[2])
+return {1, old or ""}
+`)
+
+/*
+SaveRate
+сохраняет новое значение курса, добавляет его в историю и журнал изменений
+значение, номер версии курсов и метаданные пары (meta:) меняются атомарно (saveRateScript)
+курс зафиксированной пары меняет только ProviderOverride, остальные источники получают ErrPinned -
+фиксация проверяется в той же команде что и запись, поэтому фиксация во время запроса к источнику не теряется
+actor, provider - кто и из какого источника изменил курс
+*/
+func (server *CurrencyServer) SaveRate(ctx context.Context, key string, value money.Amount, actor Actor, provider string) error {
+	checkPin := "1"
+	if provider == ProviderOverride {
+		checkPin = "0"
+	}
+	now := time.Now()
+	keys := []string{key, VersionKey, metaKey(key), pinKey(key)}
+	res, err := saveRateScript.Run(server.rdb(ctx), keys, value.String(), now.Unix(), checkPin).Result()
+	if err != nil {
+		Logger.Debugw("Can't set value to Redis", "key", key, "err", err)
+		return err
+	}
+	if reply, _ := res.([]interface{}); len(reply) < 2 {
+		Logger.Debugw("Currency is pinned - rate not saved", "pair", key, "provider", provider)
+		return ErrPinned
+	}
+	oldStr, _ := res.([]interface{})[1].(string)
+	old, _ := money.Parse(oldStr)
+	server.AddAudit(ctx, key, old, value, actor, provider)
+	server.AddHistory(ctx, key, value, now)
+	server.Indicators.Add(key, value, now)
+	return nil
+}
+
+/*
+GetRSnapshot
+читает значения пар и номер версии одной командой MGET - значения согласованы между собой
+*/
+func (server *CurrencyServer) GetRSnapshot(ctx context.Context, keys []string) (ReturnSnapshot, error) {
+	snapshot := ReturnSnapshot{Rates: map[string]money.Amount{}}
+	values, err := server.rdb(ctx).MGet(append([]string{VersionKey}, keys...)...).Result()
+	if err != nil {
+		return snapshot, err
+	}
+
+	if v, ok := values[0].(string); ok {
+		snapshot.Version, _ = strconv.ParseInt(v, 10, 64)
+	}
+	for i, key := range keys {
+		snapshot.Rates[key] = money.Zero
+		str, ok := values[i+1].(string)
+		if !ok {
+			continue
+		}
+		if val, err := money.Parse(str); err == nil {
+			snapshot.Rates[key] = val
+		}
+	}
+	return snapshot, nil
+}
+
+func (server *CurrencyServer) SetRValue(ctx context.Context, key string, value money.Amount) {
+	err := server.rdb(ctx).Set(key, value.String(), 0).Err()
 	if err != nil {
 		Logger.Debugw("Can't set value to Redis")
 		return
 	}
 }
 
-func (server *CurrencyServer) GetRValue(key string) float64 {
-	val, err := server.RClient.Get(key).Float64()
+func (server *CurrencyServer) GetRValue(ctx context.Context, key string) money.Amount {
+	str, err := server.rdb(ctx).Get(key).Result()
 	if err != nil {
 		Logger.Debugw("Can't get value from Redis")
-		return 0.00
+		return money.Zero
+	}
+	val, err := money.Parse(str)
+	if err != nil {
+		Logger.Debugw("Can't parse value from Redis", "key", key, "value", str)
+		return money.Zero
 	}
 	return val
 }
@@ -1,13 +1,18 @@
 package libcurrency
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/SArtemJ/CurrencyGameExample/currency/money"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestServerStart(t *testing.T) {
@@ -20,7 +25,7 @@ func TestServerStart(t *testing.T) {
 		return
 	}
 	assert.Equal(t, "PONG", str)
-	assert.Equal(t, 4, len(server.Currency))
+	assert.Equal(t, len(CryptoPairs)+len(FiatPairs), len(server.Currency))
 }
 
 func TestUpdateAllCurrency(t *testing.T) {
@@ -33,17 +38,17 @@ func TestUpdateAllCurrency(t *testing.T) {
 	server.GetRouter().ServeHTTP(w, req)
 	assert.Equal(t, http.StatusOK, w.Code)
 
-	value := server.GetRValue("BTCUSD")
-	assert.NotEqual(t, float64(0), value)
+	value := server.GetRValue(context.Background(), "BTCUSD")
+	assert.False(t, value.IsZero())
 
-	value = server.GetRValue("BTCEUR")
-	assert.NotEqual(t, float64(0), value)
+	value = server.GetRValue(context.Background(), "BTCEUR")
+	assert.False(t, value.IsZero())
 
-	value = server.GetRValue("BTCGBP")
-	assert.NotEqual(t, float64(0), value)
+	value = server.GetRValue(context.Background(), "BTCGBP")
+	assert.False(t, value.IsZero())
 
-	value = server.GetRValue("BTCRUB")
-	assert.NotEqual(t, float64(0), value)
+	value = server.GetRValue(context.Background(), "BTCRUB")
+	assert.False(t, value.IsZero())
 }
 
 func TestUpdateOneCurrency(t *testing.T) {
@@ -56,12 +61,12 @@ func TestUpdateOneCurrency(t *testing.T) {
 	server.GetRouter().ServeHTTP(w, req)
 	assert.Equal(t, http.StatusOK, w.Code)
 
-	value := server.GetRValue("BTCRUB")
-	assert.NotEqual(t, float64(0), value)
+	value := server.GetRValue(context.Background(), "BTCRUB")
+	assert.False(t, value.IsZero())
 
-	server.SetRValue("BTCRUB", 155.55)
-	value = server.GetRValue("BTCRUB")
-	assert.Equal(t, 155.55, value)
+	server.SetRValue(context.Background(), "BTCRUB", money.MustParse("155.55"))
+	value = server.GetRValue(context.Background(), "BTCRUB")
+	assert.Equal(t, "155.55", value.String())
 }
 
 func TestGetOneCurrency(t *testing.T) {
@@ -82,7 +87,7 @@ func TestGetOneCurrency(t *testing.T) {
 
 	var rc ReturnCurrency
 	_ = json.NewDecoder(w.Body).Decode(&rc)
-	assert.NotEqual(t, float64(0), rc.Value)
+	assert.False(t, rc.Value.IsZero())
 }
 
 func TestGetAllCurrency(t *testing.T) {
@@ -101,11 +106,473 @@ func TestGetAllCurrency(t *testing.T) {
 	server.GetRouter().ServeHTTP(w, req)
 	assert.Equal(t, http.StatusOK, w.Code)
 
-	var rc map[string]float64
+	var rc ReturnAll
 	_ = json.NewDecoder(w.Body).Decode(&rc)
-	assert.Equal(t, 4, len(rc))
+	assert.Equal(t, len(CryptoPairs)+len(FiatPairs), len(rc.Rates))
 
-	for _, v := range rc {
-		assert.NotEqual(t, float64(0), v)
+	for _, v := range rc.Rates {
+		assert.False(t, v.IsZero())
 	}
 }
+
+func TestGetCurrencyHistory(t *testing.T) {
+	server := GetTestServer()
+	server.RedisConnection()
+
+	request := fmt.Sprintf("http://localhost:8888/api/update/BTCUSD")
+	req, _ := http.NewRequest("PATCH", request, nil)
+	w := httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	request = fmt.Sprintf("http://localhost:8888/api/history/BTCUSD?since=1h")
+	req, _ = http.NewRequest("GET", request, nil)
+	w = httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var points []RatePoint
+	_ = json.NewDecoder(w.Body).Decode(&points)
+	assert.NotEqual(t, 0, len(points))
+
+	request = fmt.Sprintf("http://localhost:8888/api/history/BTCUSD?since=1x")
+	req, _ = http.NewRequest("GET", request, nil)
+	w = httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHistoryRetention(t *testing.T) {
+	server := GetTestServer()
+	server.RedisConnection()
+	defer server.SetHistoryRetention(0)
+	ctx := context.Background()
+	server.RClient.Del(historyKey("ETHUSD"))
+
+	server.AddHistory(ctx, "ETHUSD", money.MustParse("470"), time.Now().Add(-48*time.Hour))
+	server.SetHistoryRetention(24 * time.Hour)
+	server.AddHistory(ctx, "ETHUSD", money.MustParse("471"), time.Now())
+
+	points, err := server.GetHistory(ctx, "ETHUSD", time.Time{}, time.Time{})
+	assert.NoError(t, err)
+	if assert.Len(t, points, 1) {
+		assert.Equal(t, "471", points[0].Value.String())
+	}
+
+	d, err := ParseRetention("90d")
+	assert.NoError(t, err)
+	assert.Equal(t, 90*24*time.Hour, d)
+	_, err = ParseRetention("-1h")
+	assert.Error(t, err)
+}
+
+func TestSyncIndicators(t *testing.T) {
+	server := GetTestServer()
+	server.RedisConnection()
+	ctx := context.Background()
+	server.RClient.Del(historyKey("ETHUSD"))
+	indicators := server.Indicators
+	defer func() { server.Indicators = indicators }()
+	server.Indicators = NewIndicators([]int{2})
+
+	// курсы записывает ведущая реплика - в индикаторы ведомой они попадают только из истории
+	start := time.Now().Add(-time.Minute).Truncate(time.Second)
+	server.AddHistory(ctx, "ETHUSD", money.MustParse("470"), start)
+	server.AddHistory(ctx, "ETHUSD", money.MustParse("480"), start.Add(time.Millisecond))
+	server.SyncIndicators(ctx)
+	sma, _ := server.Indicators.Get("ETHUSD", IndicatorSMA, 2)
+	assert.Equal(t, 2, sma.Samples)
+	assert.Equal(t, "475", sma.Value.String())
+
+	// значения уже добавленные в индикаторы не добавляются повторно
+	server.AddHistory(ctx, "ETHUSD", money.MustParse("490"), start.Add(time.Second))
+	server.SyncIndicators(ctx)
+	ema, _ := server.Indicators.Get("ETHUSD", IndicatorEMA, 2)
+	assert.Equal(t, 3, ema.Samples)
+	sma, _ = server.Indicators.Get("ETHUSD", IndicatorSMA, 2)
+	assert.Equal(t, "485", sma.Value.String())
+}
+
+func TestExportCurrencyHistory(t *testing.T) {
+	server := GetTestServer()
+	server.RedisConnection()
+	ctx := context.Background()
+	server.RClient.Del(historyKey("BTCEUR"))
+
+	// больше одной части чтения из Redis
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	total := HistoryScanBatch*2 + 10
+	for i := 0; i < total; i++ {
+		server.AddHistory(ctx, "BTCEUR", money.New(int64(500000+i), -2), start.Add(time.Millisecond*time.Duration(i)))
+	}
+
+	req, _ := http.NewRequest("GET", "http://localhost:8888/api/history/BTCEUR/export?format=csv", nil)
+	w := httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv; charset=UTF-8", w.Header().Get("Content-Type"))
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	require.Len(t, lines, total+1)
+	assert.Equal(t, "time,pair,value", lines[0])
+	assert.True(t, strings.HasSuffix(lines[1], ",BTCEUR,5000"))
+	assert.True(t, strings.HasSuffix(lines[total], ",BTCEUR,5020.09"))
+
+	// значение добавленное перед уже прочитанными не повторяет и не пропускает следующие
+	seen := map[time.Time]bool{}
+	err := server.ScanHistory(ctx, "BTCEUR", time.Time{}, time.Time{}, func(p RatePoint) error {
+		assert.False(t, seen[p.Time], "duplicate %s", p.Time)
+		seen[p.Time] = true
+		if len(seen) == HistoryScanBatch+10 {
+			server.AddHistory(ctx, "BTCEUR", money.MustParse("4999"), start.Add(time.Microsecond*500))
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, total, len(seen))
+
+	// за период - вместе со значением добавленным во время чтения
+	export := fmt.Sprintf("http://localhost:8888/api/history/BTCEUR/export?format=jsonl&from=%d&to=%d",
+		start.Unix(), start.Add(time.Second*3).Unix())
+	req, _ = http.NewRequest("GET", export, nil)
+	w = httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, total+1, strings.Count(w.Body.String(), "\n"))
+
+	req, _ = http.NewRequest("GET", "http://localhost:8888/api/history/BTCEUR/export?format=xls", nil)
+	w = httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestImportCurrencyHistory(t *testing.T) {
+	server := GetTestServer()
+	server.AdminToken = "secret"
+	server.RedisConnection()
+	server.RClient.Del(historyKey("BTCGBP"))
+	server.AddHistory(context.Background(), "BTCGBP", money.MustParse("4900"), time.Unix(1531735200, 0))
+
+	data := "time,pair,value\n" +
+		"2018-07-16T10:00:00Z,BTCGBP,4900\n" + // уже есть в истории
+		"2018-07-16T11:00:00Z,BTCGBP,4910\n" +
+		"2018-07-16T11:00:00Z,BTCGBP,4910\n" + // повтор в файле
+		"2018-07-16T12:00:00Z,BTCGBP,oops\n"
+
+	req, _ := http.NewRequest("POST", "http://localhost:8888/api/history/BTCGBP/import", strings.NewReader(data))
+	w := httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req, _ = http.NewRequest("POST", "http://localhost:8888/api/history/BTCGBP/import", strings.NewReader(data))
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var summary ImportSummary
+	_ = json.NewDecoder(w.Body).Decode(&summary)
+	assert.Equal(t, 4, summary.Read)
+	assert.Equal(t, 1, summary.Inserted)
+	assert.Equal(t, 2, summary.Skipped)
+	assert.Equal(t, 1, summary.Invalid)
+
+	points, _ := server.GetHistory(context.Background(), "BTCGBP", time.Time{}, time.Time{})
+	assert.Equal(t, 2, len(points))
+	// индикаторы пары пересчитаны по истории с импортированным значением
+	sma, _ := server.Indicators.Get("BTCGBP", IndicatorSMA, server.Indicators.Windows[0])
+	assert.Equal(t, 2, sma.Samples)
+
+	req, _ = http.NewRequest("POST", "http://localhost:8888/api/history/BTCGBP/import", strings.NewReader("date,rate\n"))
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestImportHistoryStats(t *testing.T) {
+	server := GetTestServer()
+	server.RedisConnection()
+	ctx := context.Background()
+	server.RClient.Del(historyKey("BTCGBP"))
+	server.SaveRate(ctx, "BTCGBP", money.MustParse("4900"), TickerActor, ProviderBitcoinAverage)
+
+	getStats := func() RateStats {
+		req, _ := http.NewRequest("GET", "http://localhost:8888/api/stats/BTCGBP", nil)
+		w := httptest.NewRecorder()
+		server.GetRouter().ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		var st RateStats
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&st))
+		return st
+	}
+	before := getStats()
+	assert.Equal(t, 1, before.Periods["1h"].Count)
+
+	// импорт меняет версию пары - статистика пересчитывается, а не берется из кеша
+	data := "time,value\n" + time.Now().Add(-time.Minute*30).UTC().Format(time.RFC3339) + ",4800\n"
+	summary, err := server.ImportHistory(ctx, strings.NewReader(data), "BTCGBP")
+	require.NoError(t, err)
+	assert.Equal(t, 1, summary.Inserted)
+
+	after := getStats()
+	assert.True(t, after.Version > before.Version)
+	assert.Equal(t, 2, after.Periods["1h"].Count)
+	assert.Equal(t, "4800", after.Periods["1h"].Min.String())
+}
+
+func TestQuarantine(t *testing.T) {
+	server := GetTestServer()
+	server.RedisConnection()
+	server.AdminToken = "test-token"
+	guard := server.Guard
+	server.Guard = NewRateGuard(20, 3)
+	defer func() { server.Guard = guard }()
+	ctx := context.Background()
+
+	server.SaveRate(ctx, "BTCGBP", money.MustParse("4900"), TickerActor, ProviderBitcoinAverage)
+	assert.False(t, server.GuardRate(ctx, "BTCGBP", money.MustParse("490000"), TickerActor, ProviderBitcoinAverage))
+	assert.False(t, server.GuardRate(ctx, "BTCGBP", money.Zero, TickerActor, ProviderBitcoinAverage))
+	assert.Equal(t, "4900", server.GetRValue(ctx, "BTCGBP").String())
+	assert.True(t, server.GuardRate(ctx, "BTCGBP", money.MustParse("4950"), TickerActor, ProviderBitcoinAverage))
+
+	req, _ := http.NewRequest("GET", "http://localhost:8888/api/admin/quarantine?pair=BTCGBP&count=2", nil)
+	w := httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req.Header.Set("Authorization", "Bearer test-token")
+	w = httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var quarantine ReturnQuarantine
+	_ = json.NewDecoder(w.Body).Decode(&quarantine)
+	if assert.Equal(t, 2, len(quarantine.Entries)) {
+		assert.Equal(t, "0", quarantine.Entries[0].Rejected.String())
+		assert.Equal(t, "non-positive value", quarantine.Entries[0].Reason)
+		e := quarantine.Entries[1]
+		assert.Equal(t, "BTCGBP", e.Pair)
+		assert.Equal(t, "4900", e.Current.String())
+		assert.Equal(t, "490000", e.Rejected.String())
+		assert.Equal(t, "9900.00", e.Deviation)
+		assert.Equal(t, 1, e.Confirmed)
+		assert.Equal(t, 3, e.Required)
+	}
+}
+
+func TestGetSnapshotCurrency(t *testing.T) {
+	server := GetTestServer()
+	server.RedisConnection()
+
+	before, err := server.GetRSnapshot(context.Background(), []string{"BTCUSD"})
+	assert.NoError(t, err)
+	server.SaveRate(context.Background(), "BTCUSD", money.MustParse("6512.37"), TickerActor, ProviderBitcoinAverage)
+	server.SaveRate(context.Background(), "BTCEUR", money.MustParse("5570.11"), TickerActor, ProviderBitcoinAverage)
+
+	request := fmt.Sprintf("http://localhost:8888/api/currency?types=BTCUSD,BTCEUR")
+	req, _ := http.NewRequest("GET", request, nil)
+	w := httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var snapshot ReturnSnapshot
+	_ = json.NewDecoder(w.Body).Decode(&snapshot)
+	assert.Equal(t, before.Version+2, snapshot.Version)
+	assert.Equal(t, "6512.37", snapshot.Rates["BTCUSD"].String())
+	assert.Equal(t, "5570.11", snapshot.Rates["BTCEUR"].String())
+
+	request = fmt.Sprintf("http://localhost:8888/api/currency?types=BTCUSD,XXX")
+	req, _ = http.NewRequest("GET", request, nil)
+	w = httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestConditionalGetCurrency(t *testing.T) {
+	server := GetTestServer()
+	server.RedisConnection()
+	server.SaveRate(context.Background(), "BTCGBP", money.MustParse("4900.5"), TickerActor, ProviderBitcoinAverage)
+
+	request := fmt.Sprintf("http://localhost:8888/api/currency/BTCGBP")
+	req, _ := http.NewRequest("GET", request, nil)
+	w := httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	lastModified := w.Header().Get("Last-Modified")
+	assert.NotEqual(t, "", etag)
+	assert.NotEqual(t, "", lastModified)
+
+	req, _ = http.NewRequest("GET", request, nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	req, _ = http.NewRequest("GET", request, nil)
+	req.Header.Set("If-Modified-Since", lastModified)
+	w = httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	server.SaveRate(context.Background(), "BTCGBP", money.MustParse("4900.5"), TickerActor, ProviderBitcoinAverage)
+	req, _ = http.NewRequest("GET", request, nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	request = fmt.Sprintf("http://localhost:8888/api/currencyall")
+	req, _ = http.NewRequest("GET", request, nil)
+	w = httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	req, _ = http.NewRequest("GET", request, nil)
+	req.Header.Set("If-None-Match", w.Header().Get("ETag"))
+	w = httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+}
+
+func TestPinCurrency(t *testing.T) {
+	server := GetTestServer()
+	server.RedisConnection()
+	server.AdminToken = "test-token"
+	defer server.DeletePin(context.Background(), "BTCRUB")
+
+	request := fmt.Sprintf("http://localhost:8888/api/admin/pin/BTCRUB?value=5000000&ttl=1h")
+	req, _ := http.NewRequest("PUT", request, nil)
+	w := httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req, _ = http.NewRequest("PUT", request, nil)
+	req.Header.Set("Authorization", "Bearer test-token")
+	w = httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	assert.True(t, server.CurrencyUpdate(context.Background(), "BTCRUB", TickerActor))
+	assert.Equal(t, "5000000", server.GetRValue(context.Background(), "BTCRUB").String())
+
+	request = fmt.Sprintf("http://localhost:8888/api/currency/BTCRUB")
+	req, _ = http.NewRequest("GET", request, nil)
+	w = httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	var rc ReturnCurrency
+	_ = json.NewDecoder(w.Body).Decode(&rc)
+	assert.True(t, rc.Overridden)
+	assert.Equal(t, "5000000", rc.Value.String())
+
+	// источники не меняют зафиксированный курс, ручное обновление - 409
+	assert.Equal(t, ErrPinned, server.SaveRate(context.Background(), "BTCRUB", money.MustParse("400000"), TickerActor, ProviderBitcoinAverage))
+	request = fmt.Sprintf("http://localhost:8888/api/update/BTCRUB")
+	req, _ = http.NewRequest("PATCH", request, nil)
+	w = httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "5000000", server.GetRValue(context.Background(), "BTCRUB").String())
+
+	request = fmt.Sprintf("http://localhost:8888/api/currencyall")
+	req, _ = http.NewRequest("GET", request, nil)
+	w = httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	var all ReturnAll
+	_ = json.NewDecoder(w.Body).Decode(&all)
+	assert.Contains(t, all.Overridden, "BTCRUB")
+	etag := w.Header().Get("ETag")
+
+	// фиксация истекла - ETag меняется сразу, версия - после ReleasePins
+	server.RClient.Del(pinKey("BTCRUB"))
+	metas, err := server.GetRMeta(context.Background(), "BTCRUB")
+	require.NoError(t, err)
+	version := metas["BTCRUB"].Version
+	req, _ = http.NewRequest("GET", request, nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	server.ReleasePins(context.Background())
+	metas, err = server.GetRMeta(context.Background(), "BTCRUB")
+	require.NoError(t, err)
+	assert.Equal(t, version+1, metas["BTCRUB"].Version)
+	assert.False(t, metas["BTCRUB"].Pinned)
+
+	request = fmt.Sprintf("http://localhost:8888/api/admin/pin/BTCRUB")
+	req, _ = http.NewRequest("DELETE", request, nil)
+	req.Header.Set("Authorization", "Bearer test-token")
+	w = httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	_, ok := server.GetPin(context.Background(), "BTCRUB")
+	assert.False(t, ok)
+}
+
+func TestGetAudit(t *testing.T) {
+	server := GetTestServer()
+	server.RedisConnection()
+	server.AdminToken = "test-token"
+
+	server.SaveRate(context.Background(), "BTCEUR", money.MustParse("5500"), TickerActor, ProviderBitcoinAverage)
+	request := fmt.Sprintf("http://localhost:8888/api/update/BTCEUR")
+	req, _ := http.NewRequest("PATCH", request, nil)
+	req.Header.Set("Authorization", "Bearer test-token")
+	req.Header.Set("X-Actor", "qa")
+	req.Header.Set("X-Forwarded-For", "1.2.3.4")
+	req.RemoteAddr = "10.0.0.1:5555"
+	w := httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	request = fmt.Sprintf("http://localhost:8888/api/audit?count=1")
+	req, _ = http.NewRequest("GET", request, nil)
+	req.Header.Set("Authorization", "Bearer test-token")
+	w = httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var audit ReturnAudit
+	_ = json.NewDecoder(w.Body).Decode(&audit)
+	assert.Equal(t, 1, len(audit.Entries))
+	assert.NotEqual(t, "", audit.Next)
+	e := audit.Entries[0]
+	assert.Equal(t, "BTCEUR", e.Pair)
+	assert.Equal(t, "5500", e.Old.String())
+	assert.Equal(t, "qa", e.Actor)
+	// 10.0.0.1 не доверенный прокси - X-Forwarded-For не учитывается
+	assert.Equal(t, "10.0.0.1", e.IP)
+	assert.Equal(t, "10.0.0.1", e.Remote)
+	assert.Equal(t, SourceAPI, e.Source)
+	assert.Equal(t, ProviderBitcoinAverage, e.Provider)
+}
+
+func TestLeaderElection(t *testing.T) {
+	server := GetTestServer()
+	if !server.RedisConnect() {
+		return
+	}
+	server.RClient.Del(LeaderKey)
+
+	first := NewLeader("first", time.Millisecond*300)
+	second := NewLeader("second", time.Millisecond*300)
+	assert.False(t, first.IsFollower())
+
+	first.Start(server.RClient, nil)
+	second.Start(server.RClient, nil)
+	assert.True(t, first.IsLeader())
+	assert.True(t, second.IsFollower())
+	assert.Equal(t, "first", first.CurrentLeader(server.RClient))
+
+	// лидер упал не освободив блокировку - через TTL ее захватывает вторая реплика
+	first.m.Lock()
+	close(first.stop)
+	first.started = false
+	first.m.Unlock()
+	time.Sleep(time.Millisecond * 500)
+	assert.True(t, second.IsLeader())
+	assert.Equal(t, "second", second.CurrentLeader(server.RClient))
+
+	second.Stop()
+	assert.Equal(t, "", second.CurrentLeader(server.RClient))
+}
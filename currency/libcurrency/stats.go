@@ -0,0 +1,164 @@
+package libcurrency
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/SArtemJ/CurrencyGameExample/currency/money"
+	"github.com/SArtemJ/CurrencyGameExample/currency/service"
+	"github.com/gorilla/mux"
+)
+
+/*
+StatsPeriods
+периоды за которые считается статистика изменения курса
+*/
+var StatsPeriods = []struct {
+	Name     string
+	Duration time.Duration
+}{
+	{"1h", time.Hour},
+	{"24h", time.Hour * 24},
+	{"7d", time.Hour * 24 * 7},
+}
+
+/*
+PeriodStats
+изменение курса за период
+Change - абсолютное изменение, Percent - изменение в процентах от первого значения периода
+*/
+type PeriodStats struct {
+	Change  money.Amount `json:"change"`
+	Percent money.Amount `json:"percent"`
+	Min     money.Amount `json:"min"`
+	Max     money.Amount `json:"max"`
+	Mean    money.Amount `json:"mean"`
+	Count   int          `json:"count"`
+}
+
+type RateStats struct {
+	Pair    string                 `json:"pair"`
+	Current money.Amount           `json:"current"`
+	Version int64                  `json:"version"`
+	Periods map[string]PeriodStats `json:"periods"`
+}
+
+/*
+ComputeStats
+статистика по истории курса за каждый период из StatsPeriods
+points - история в порядке возрастания времени
+*/
+func ComputeStats(points []RatePoint, now time.Time) map[string]PeriodStats {
+	result := map[string]PeriodStats{}
+	for _, period := range StatsPeriods {
+		from := now.Add(-period.Duration)
+		var st PeriodStats
+		var first, last, sum money.Amount
+		for _, p := range points {
+			if p.Time.Before(from) {
+				continue
+			}
+			if st.Count == 0 {
+				first, st.Min, st.Max = p.Value, p.Value, p.Value
+			}
+			if p.Value.Cmp(st.Min) < 0 {
+				st.Min = p.Value
+			}
+			if p.Value.Cmp(st.Max) > 0 {
+				st.Max = p.Value
+			}
+			last = p.Value
+			sum = sum.Add(p.Value)
+			st.Count++
+		}
+		if st.Count > 0 {
+			st.Change = last.Sub(first)
+			// от нулевого первого значения процент не считается
+			if ratio, err := st.Change.Div(first); err == nil {
+				st.Percent = ratio.Mul(money.New(100, 0)).RoundPlaces(4)
+			}
+			mean, _ := sum.Div(money.New(int64(st.Count), 0))
+			st.Mean = mean.RoundPlaces(8)
+		}
+		result[period.Name] = st
+	}
+	return result
+}
+
+/*
+GetRateStats
+статистика пары - считается по истории и кешируется до следующего обновления пары
+(кеш сбрасывается когда меняется версия пары в meta:)
+*/
+func (server *CurrencyServer) GetRateStats(ctx context.Context, pair string) (RateStats, error) {
+	metas, err := server.GetRMeta(ctx, pair)
+	if err != nil {
+		return RateStats{}, err
+	}
+	meta := metas[pair]
+
+	server.statsM.Lock()
+	cached, ok := server.stats[pair]
+	server.statsM.Unlock()
+	if ok && cached.Version == meta.Version {
+		return cached, nil
+	}
+
+	now := time.Now()
+	points, err := server.GetHistory(ctx, pair, now.Add(-StatsPeriods[len(StatsPeriods)-1].Duration), time.Time{})
+	if err != nil {
+		return RateStats{}, err
+	}
+	st := RateStats{
+		Pair:    pair,
+		Current: meta.Value,
+		Version: meta.Version,
+		Periods: ComputeStats(points, now),
+	}
+
+	server.statsM.Lock()
+	server.stats[pair] = st
+	server.statsM.Unlock()
+	return st, nil
+}
+
+func (server *CurrencyServer) GetOneStats(w http.ResponseWriter, r *http.Request) {
+	logger := service.RequestLogger(r)
+	typeC := mux.Vars(r)["type"]
+	if !server.HasPair(typeC) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "Bad request incorrect type currency")
+		logger.Debugw("Not exist type of currency for stats method", "err ", typeC)
+		return
+	}
+
+	st, err := server.GetRateStats(r.Context(), typeC)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, "Can't get stats from Redis")
+		logger.Debugw("Can't get stats from Redis", "err", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	json.NewEncoder(w).Encode(st)
+}
+
+func (server *CurrencyServer) GetAllStats(w http.ResponseWriter, r *http.Request) {
+	logger := service.RequestLogger(r)
+	all := map[string]RateStats{}
+	for _, i := range server.Pairs() {
+		st, err := server.GetRateStats(r.Context(), i)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, "Can't get stats from Redis")
+			logger.Debugw("Can't get stats from Redis", "err", err)
+			return
+		}
+		all[i] = st
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	json.NewEncoder(w).Encode(all)
+}
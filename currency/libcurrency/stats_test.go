@@ -0,0 +1,40 @@
+package libcurrency
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SArtemJ/CurrencyGameExample/currency/money"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComputeStats(t *testing.T) {
+	now := time.Now()
+	points := []RatePoint{
+		{Time: now.Add(-time.Hour * 48), Value: money.MustParse("5000")},
+		{Time: now.Add(-time.Hour * 2), Value: money.MustParse("6000")},
+		{Time: now.Add(-time.Minute * 30), Value: money.MustParse("6200")},
+		{Time: now.Add(-time.Minute * 10), Value: money.MustParse("6100")},
+	}
+	st := ComputeStats(points, now)
+
+	assert.Equal(t, 2, st["1h"].Count)
+	assert.Equal(t, "-100", st["1h"].Change.String())
+	assert.Equal(t, "-1.6129", st["1h"].Percent.String())
+
+	assert.Equal(t, 3, st["24h"].Count)
+	assert.Equal(t, "6000", st["24h"].Min.String())
+	assert.Equal(t, "6200", st["24h"].Max.String())
+	assert.Equal(t, "6100", st["24h"].Mean.String())
+
+	assert.Equal(t, 4, st["7d"].Count)
+	assert.Equal(t, "1100", st["7d"].Change.String())
+	assert.Equal(t, "22", st["7d"].Percent.String())
+	assert.Equal(t, "5825", st["7d"].Mean.String())
+}
+
+func TestComputeStatsEmpty(t *testing.T) {
+	st := ComputeStats(nil, time.Now())
+	assert.Equal(t, 0, st["24h"].Count)
+	assert.True(t, st["24h"].Change.IsZero())
+}
@@ -7,6 +7,10 @@ func GetTestApp(cfg map[string]interface{}) *Application {
 		testApp = NewApplication()
 		testApp.Configure("currency_test")
 		testApp.Init()
+		// тесты записывают в Redis произвольные курсы и обновляют их из внешних источников
+		testApp.Server.Guard.Set(0, 1)
+		// в тестах есть история за прошлые годы
+		testApp.Server.SetHistoryRetention(0)
 	}
 	return testApp
 }
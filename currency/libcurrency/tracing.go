@@ -0,0 +1,50 @@
+package libcurrency
+
+import (
+	"context"
+
+	"github.com/SArtemJ/CurrencyGameExample/currency/service"
+	"github.com/go-redis/redis"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ServiceName = "currency"
+)
+
+var (
+	Tracer = otel.Tracer("github.com/SArtemJ/CurrencyGameExample/currency/libcurrency")
+)
+
+/*
+rdb
+клиент Redis с контекстом запроса - каждая команда и pipeline записываются в отдельный span
+*/
+func (server *CurrencyServer) rdb(ctx context.Context) *redis.Client {
+	client := server.RClient.WithContext(ctx)
+	client.WrapProcess(func(old func(cmd redis.Cmder) error) func(cmd redis.Cmder) error {
+		return func(cmd redis.Cmder) error {
+			_, span := Tracer.Start(ctx, "redis "+cmd.Name(), trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(attribute.String("db.system", "redis")))
+			err := old(cmd)
+			service.EndSpan(span, err, redis.Nil)
+			return err
+		}
+	})
+	client.WrapProcessPipeline(func(old func(cmds []redis.Cmder) error) func(cmds []redis.Cmder) error {
+		return func(cmds []redis.Cmder) error {
+			names := make([]string, len(cmds))
+			for i, cmd := range cmds {
+				names[i] = cmd.Name()
+			}
+			_, span := Tracer.Start(ctx, "redis pipeline", trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(attribute.String("db.system", "redis"), attribute.StringSlice("db.commands", names)))
+			err := old(cmds)
+			service.EndSpan(span, err, redis.Nil)
+			return err
+		}
+	})
+	return client
+}
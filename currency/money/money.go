@@ -0,0 +1,207 @@
+package money
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/shopspring/decimal"
+	"gopkg.in/mgo.v2/bson"
+)
+
+/*
+Amount
+точное десятичное денежное значение - используется для всех цен и курсов валют
+в Redis хранится строкой, в MongoDB строкой, в JSON выводится числом
+*/
+type Amount struct {
+	d decimal.Decimal
+}
+
+var Zero = Amount{}
+
+// ErrDivisionByZero - делитель Div равен нулю
+var ErrDivisionByZero = errors.New("money: division by zero")
+
+/*
+New
+создает значение value * 10^exp
+например New(1299, -2) = 12.99
+*/
+func New(value int64, exp int32) Amount {
+	return Amount{d: decimal.New(value, exp)}
+}
+
+func NewFromFloat(value float64) Amount {
+	return Amount{d: decimal.NewFromFloat(value)}
+}
+
+func Parse(value string) (Amount, error) {
+	d, err := decimal.NewFromString(value)
+	if err != nil {
+		return Zero, err
+	}
+	return Amount{d: d}, nil
+}
+
+func MustParse(value string) Amount {
+	a, err := Parse(value)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+func (a Amount) Add(b Amount) Amount {
+	return Amount{d: a.d.Add(b.d)}
+}
+
+func (a Amount) Sub(b Amount) Amount {
+	return Amount{d: a.d.Sub(b.d)}
+}
+
+func (a Amount) Mul(b Amount) Amount {
+	return Amount{d: a.d.Mul(b.d)}
+}
+
+/*
+Div
+деление с точностью decimal.DivisionPrecision знаков
+при делении на ноль возвращает ErrDivisionByZero - нулевой результат не является ценой
+*/
+func (a Amount) Div(b Amount) (Amount, error) {
+	if b.IsZero() {
+		return Zero, ErrDivisionByZero
+	}
+	return Amount{d: a.d.Div(b.d)}, nil
+}
+
+/*
+Round
+округляет значение по правилам валюты code (см. PolicyOf)
+*/
+func (a Amount) Round(code string) Amount {
+	return PolicyOf(code).Round(a)
+}
+
+func (a Amount) RoundPlaces(places int32) Amount {
+	return Amount{d: a.d.Round(places)}
+}
+
+func (a Amount) IsZero() bool {
+	return a.d.IsZero()
+}
+
+func (a Amount) Sign() int {
+	return a.d.Sign()
+}
+
+func (a Amount) Cmp(b Amount) int {
+	return a.d.Cmp(b.d)
+}
+
+func (a Amount) Equal(b Amount) bool {
+	return a.d.Equal(b.d)
+}
+
+func (a Amount) Decimal() decimal.Decimal {
+	return a.d
+}
+
+/*
+Float64
+только для вывода и статистики - в расчетах не используется
+*/
+func (a Amount) Float64() float64 {
+	f, _ := a.d.Float64()
+	return f
+}
+
+func (a Amount) String() string {
+	return a.d.String()
+}
+
+/*
+StringFixed
+строка с фиксированным количеством знаков валюты code
+*/
+func (a Amount) StringFixed(code string) string {
+	return a.Round(code).d.StringFixed(MinorUnitsOf(code))
+}
+
+/*
+Format
+сумма для вывода по правилам валюты code - с единицей вывода (12.99 USD, 199467 sat)
+*/
+func (a Amount) Format(code string) string {
+	return PolicyOf(code).Format(a, code)
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.d.String()), nil
+}
+
+func (a *Amount) UnmarshalJSON(b []byte) error {
+	b = bytes.Trim(b, `"`)
+	if string(b) == "null" || len(b) == 0 {
+		*a = Zero
+		return nil
+	}
+	d, err := decimal.NewFromString(string(b))
+	if err != nil {
+		return fmt.Errorf("money: can't parse %q: %v", b, err)
+	}
+	a.d = d
+	return nil
+}
+
+func (a Amount) MarshalText() ([]byte, error) {
+	return []byte(a.d.String()), nil
+}
+
+func (a *Amount) UnmarshalText(b []byte) error {
+	d, err := decimal.NewFromString(string(b))
+	if err != nil {
+		return err
+	}
+	a.d = d
+	return nil
+}
+
+/*
+GetBSON
+в MongoDB значение хранится строкой чтобы не терять точность
+*/
+func (a Amount) GetBSON() (interface{}, error) {
+	return a.d.String(), nil
+}
+
+/*
+SetBSON
+читает строку, а также старые записи где цена хранилась как double/int
+*/
+func (a *Amount) SetBSON(raw bson.Raw) error {
+	var v interface{}
+	if err := raw.Unmarshal(&v); err != nil {
+		return err
+	}
+	switch t := v.(type) {
+	case nil:
+		*a = Zero
+	case string:
+		d, err := decimal.NewFromString(t)
+		if err != nil {
+			return err
+		}
+		a.d = d
+	case float64:
+		a.d = decimal.NewFromFloat(t)
+	case int:
+		a.d = decimal.New(int64(t), 0)
+	case int64:
+		a.d = decimal.New(t, 0)
+	default:
+		return fmt.Errorf("money: unsupported bson value %T", v)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestConvertWithoutDrift(t *testing.T) {
+	usd := New(1299, -2)
+	btcusd := MustParse("6512.37")
+	btceur := MustParse("5570.11")
+
+	inBTC, err := usd.Div(btcusd)
+	require.NoError(t, err)
+	assert.Equal(t, "0.00199467", inBTC.Round("BTC").String())
+	assert.Equal(t, "11.11", inBTC.Mul(btceur).Round("EUR").String())
+
+	assert.Equal(t, "0.3", MustParse("0.1").Add(MustParse("0.2")).String())
+}
+
+func TestDivByZero(t *testing.T) {
+	v, err := New(1, 0).Div(Zero)
+	assert.Equal(t, ErrDivisionByZero, err)
+	assert.True(t, v.IsZero())
+}
+
+func TestJSON(t *testing.T) {
+	b, err := json.Marshal(struct {
+		Value Amount `json:"value"`
+	}{MustParse("6512.12345678")})
+	require.NoError(t, err)
+	assert.Equal(t, `{"value":6512.12345678}`, string(b))
+
+	var v struct {
+		Value Amount `json:"value"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(`{"value":"12.5"}`), &v))
+	assert.Equal(t, "12.5", v.Value.String())
+	require.NoError(t, json.Unmarshal([]byte(`{"value":0.1}`), &v))
+	assert.Equal(t, "0.1", v.Value.String())
+}
+
+func TestBSON(t *testing.T) {
+	type doc struct {
+		USD Amount `bson:"USD"`
+	}
+	b, err := bson.Marshal(doc{USD: New(1299, -2)})
+	require.NoError(t, err)
+
+	var raw bson.M
+	require.NoError(t, bson.Unmarshal(b, &raw))
+	assert.Equal(t, "12.99", raw["USD"])
+
+	var d doc
+	require.NoError(t, bson.Unmarshal(b, &d))
+	assert.Equal(t, "12.99", d.USD.String())
+
+	legacy, _ := bson.Marshal(bson.M{"USD": 9.99})
+	require.NoError(t, bson.Unmarshal(legacy, &d))
+	assert.Equal(t, "9.99", d.USD.String())
+}
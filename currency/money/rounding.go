@@ -0,0 +1,226 @@
+package money
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/shopspring/decimal"
+)
+
+/*
+DefaultMinorUnits
+количество знаков после запятой для валюты которой нет в MinorUnits
+*/
+const DefaultMinorUnits int32 = 2
+
+/*
+MinorUnits
+правила округления - количество знаков после запятой для каждой валюты
+*/
+var MinorUnits = map[string]int32{
+	"USD":  2,
+	"EUR":  2,
+	"GBP":  2,
+	"RUB":  2,
+	"JPY":  0,
+	"BTC":  8,
+	"ETH":  8,
+	"LTC":  8,
+	"USDT": 6,
+}
+
+/*
+RoundingMode
+half_up - половина округляется от нуля (0.125 -> 0.13), по умолчанию
+half_even - банковское округление к четному (0.125 -> 0.12)
+*/
+type RoundingMode string
+
+const (
+	RoundHalfUp   RoundingMode = "half_up"
+	RoundHalfEven RoundingMode = "half_even"
+)
+
+func ParseRoundingMode(value string) (RoundingMode, error) {
+	switch RoundingMode(strings.ToLower(value)) {
+	case "", RoundHalfUp:
+		return RoundHalfUp, nil
+	case RoundHalfEven:
+		return RoundHalfEven, nil
+	}
+	return "", fmt.Errorf("money: unknown rounding mode %q (half_up, half_even)", value)
+}
+
+/*
+DisplayUnits
+единицы для вывода суммы - 1 единица валюты = 10^exp единиц вывода (1 BTC = 10^8 sat)
+*/
+var DisplayUnits = map[string]map[string]int32{
+	"BTC": {"mBTC": 3, "uBTC": 6, "sat": 8},
+	"LTC": {"litoshi": 8},
+	"ETH": {"gwei": 9},
+}
+
+/*
+Policy
+правила округления и вывода сумм в валюте
+MinorUnits - знаков после запятой, Mode - способ округления,
+Unit - единица вывода (sat, mBTC), пусто - код валюты
+*/
+type Policy struct {
+	MinorUnits int32        `json:"minor_units"`
+	Mode       RoundingMode `json:"mode"`
+	Unit       string       `json:"unit,omitempty"`
+}
+
+var (
+	policiesM sync.RWMutex
+	policies  = map[string]Policy{}
+)
+
+/*
+PolicyOf
+правила валюты code - заданные через SetPolicy, SetPolicies или по умолчанию (MinorUnits, half_up)
+*/
+func PolicyOf(code string) Policy {
+	code = strings.ToUpper(code)
+	policiesM.RLock()
+	p, ok := policies[code]
+	policiesM.RUnlock()
+	if ok {
+		return p
+	}
+	return DefaultPolicy(code)
+}
+
+/*
+DefaultPolicy
+правила валюты по умолчанию - знаков после запятой из MinorUnits, half_up
+*/
+func DefaultPolicy(code string) Policy {
+	units, ok := MinorUnits[strings.ToUpper(code)]
+	if !ok {
+		units = DefaultMinorUnits
+	}
+	return Policy{MinorUnits: units, Mode: RoundHalfUp}
+}
+
+/*
+SetPolicy
+задает правила валюты code, единица вывода должна быть из DisplayUnits этой валюты
+*/
+func SetPolicy(code string, p Policy) error {
+	code = strings.ToUpper(code)
+	p, err := checkPolicy(code, p)
+	if err != nil {
+		return err
+	}
+	policiesM.Lock()
+	defer policiesM.Unlock()
+	policies[code] = p
+	return nil
+}
+
+/*
+SetPolicies
+заменяет правила всех валют одним шагом - PolicyOf видит либо старые, либо новые правила
+для валют с ошибкой в правилах остаются правила по умолчанию, ошибки возвращаются вместе
+*/
+func SetPolicies(rules map[string]Policy) error {
+	codes := make([]string, 0, len(rules))
+	for code := range rules {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	next := make(map[string]Policy, len(rules))
+	var errs []string
+	for _, code := range codes {
+		p, err := checkPolicy(strings.ToUpper(code), rules[code])
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		next[strings.ToUpper(code)] = p
+	}
+
+	policiesM.Lock()
+	policies = next
+	policiesM.Unlock()
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func checkPolicy(code string, p Policy) (Policy, error) {
+	mode, err := ParseRoundingMode(string(p.Mode))
+	if err != nil {
+		return p, err
+	}
+	p.Mode = mode
+	if p.MinorUnits < 0 {
+		return p, fmt.Errorf("money: negative minor units %d for %s", p.MinorUnits, code)
+	}
+	if p.Unit != "" {
+		if _, ok := DisplayUnits[code][p.Unit]; !ok {
+			return p, fmt.Errorf("money: unknown display unit %q for %s", p.Unit, code)
+		}
+	}
+	return p, nil
+}
+
+/*
+ResetPolicies
+возвращает правила по умолчанию для всех валют
+*/
+func ResetPolicies() {
+	SetPolicies(nil)
+}
+
+func MinorUnitsOf(code string) int32 {
+	return PolicyOf(code).MinorUnits
+}
+
+/*
+Round
+округляет значение по правилам
+*/
+func (p Policy) Round(a Amount) Amount {
+	if p.Mode == RoundHalfEven {
+		return Amount{d: a.d.RoundBank(p.MinorUnits)}
+	}
+	return Amount{d: a.d.Round(p.MinorUnits)}
+}
+
+/*
+Display
+округленное значение с фиксированным количеством знаков в единице вывода
+unit - единица вывода (sat), пусто если сумма выводится в самой валюте
+*/
+func (p Policy) Display(a Amount, code string) (value string, unit string) {
+	rounded := p.Round(a)
+	if exp, ok := DisplayUnits[strings.ToUpper(code)][p.Unit]; ok && p.Unit != "" {
+		places := p.MinorUnits - exp
+		if places < 0 {
+			places = 0
+		}
+		return rounded.d.Mul(decimal.New(1, exp)).StringFixed(places), p.Unit
+	}
+	return rounded.d.StringFixed(p.MinorUnits), ""
+}
+
+/*
+Format
+округленное значение с фиксированным количеством знаков и единицей вывода
+12.99 USD, 0.00199467 BTC или 199467 sat
+*/
+func (p Policy) Format(a Amount, code string) string {
+	value, unit := p.Display(a, code)
+	if unit == "" {
+		unit = strings.ToUpper(code)
+	}
+	return value + " " + unit
+}
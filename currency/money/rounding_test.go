@@ -0,0 +1,56 @@
+package money
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoundingPolicy(t *testing.T) {
+	defer ResetPolicies()
+
+	assert.Equal(t, "0.13", MustParse("0.125").Round("USD").String())
+	assert.Equal(t, "1300", MustParse("1299.5").Round("JPY").String())
+	assert.Equal(t, "0.00199467", MustParse("0.001994671").Round("BTC").String())
+	assert.Equal(t, int32(2), MinorUnitsOf("XXX"))
+
+	assert.NoError(t, SetPolicy("usd", Policy{MinorUnits: 2, Mode: RoundHalfEven}))
+	assert.Equal(t, "0.12", MustParse("0.125").Round("USD").String())
+	assert.Equal(t, "0.14", MustParse("0.135").Round("USD").String())
+	assert.Equal(t, "0.12", MustParse("0.125").StringFixed("USD"))
+
+	assert.Error(t, SetPolicy("USD", Policy{MinorUnits: 2, Mode: "ceil"}))
+	assert.Error(t, SetPolicy("USD", Policy{MinorUnits: 2, Unit: "sat"}))
+	assert.Error(t, SetPolicy("USD", Policy{MinorUnits: -1}))
+
+	ResetPolicies()
+	assert.Equal(t, RoundHalfUp, PolicyOf("USD").Mode)
+
+	// правила заменяются целиком, валюта с ошибкой остается с правилами по умолчанию
+	assert.NoError(t, SetPolicy("BTC", Policy{MinorUnits: 8, Unit: "sat"}))
+	err := SetPolicies(map[string]Policy{
+		"usd": {MinorUnits: 0, Mode: RoundHalfEven},
+		"EUR": {MinorUnits: 2, Unit: "sat"},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, Policy{MinorUnits: 0, Mode: RoundHalfEven}, PolicyOf("USD"))
+	assert.Equal(t, Policy{MinorUnits: 2, Mode: RoundHalfUp}, PolicyOf("EUR"))
+	assert.Equal(t, "", PolicyOf("BTC").Unit)
+}
+
+func TestFormat(t *testing.T) {
+	defer ResetPolicies()
+
+	btc := MustParse("0.001994671")
+	assert.Equal(t, "12.99 USD", New(1299, -2).Format("USD"))
+	assert.Equal(t, "1300 JPY", MustParse("1299.5").Format("JPY"))
+	assert.Equal(t, "0.00199467 BTC", btc.Format("BTC"))
+
+	assert.NoError(t, SetPolicy("BTC", Policy{MinorUnits: 8, Unit: "sat"}))
+	assert.Equal(t, "199467 sat", btc.Format("BTC"))
+	assert.NoError(t, SetPolicy("BTC", Policy{MinorUnits: 8, Unit: "mBTC"}))
+	assert.Equal(t, "1.99467 mBTC", btc.Format("BTC"))
+	// меньше знаков чем у единицы вывода - целое число
+	assert.NoError(t, SetPolicy("ETH", Policy{MinorUnits: 8, Unit: "gwei"}))
+	assert.Equal(t, "1994670 gwei", btc.Format("ETH"))
+}
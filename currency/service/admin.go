@@ -0,0 +1,42 @@
+package service
+
+import (
+	"crypto/subtle"
+	"io"
+	"net/http"
+	"strings"
+)
+
+/*
+AdminOnly
+доступ к административным методам только с заголовком Authorization: Bearer <admin.token>
+token - текущий токен администратора, если он не задан - административные методы отключены
+*/
+func AdminOnly(token func() string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token() == "" {
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, "Admin API is disabled")
+			return
+		}
+		if !IsAdmin(r, token()) {
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, "Bad admin token")
+			RequestLogger(r).Debugw("Bad admin token", "url", r.URL.Path, "remote", r.RemoteAddr)
+			return
+		}
+		next(w, r)
+	}
+}
+
+/*
+IsAdmin
+запрос с токеном администратора token (Authorization: Bearer <token>)
+*/
+func IsAdmin(r *http.Request, token string) bool {
+	if token == "" {
+		return false
+	}
+	value := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(value), []byte(token)) == 1
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+const (
+	Redacted = "[REDACTED]"
+)
+
+/*
+ActiveConfig
+действующие параметры для GET /admin/config
+PendingRestart - измененные параметры которые применятся после перезапуска
+*/
+type ActiveConfig struct {
+	m        sync.Mutex
+	settings map[string]interface{}
+	pending  []string
+	file     string
+	reloaded time.Time
+}
+
+type ReturnConfig struct {
+	File           string                 `json:"file,omitempty"`
+	Reloaded       time.Time              `json:"reloaded"`
+	Settings       map[string]interface{} `json:"settings"`
+	PendingRestart []string               `json:"pending_restart,omitempty"`
+}
+
+func (c *ActiveConfig) Set(file string, settings map[string]interface{}, pending []string) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.file = file
+	c.settings = settings
+	c.pending = pending
+	c.reloaded = time.Now().UTC()
+}
+
+func (c *ActiveConfig) Get() ReturnConfig {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return ReturnConfig{File: c.file, Reloaded: c.reloaded, Settings: c.settings, PendingRestart: c.pending}
+}
+
+/*
+ConfigSettings
+все параметры конфигурации, значения секретов (token, password, key) скрыты
+*/
+func ConfigSettings(cfg *viper.Viper) map[string]interface{} {
+	settings := map[string]interface{}{}
+	for _, key := range cfg.AllKeys() {
+		if isSecretSetting(key) && cfg.GetString(key) != "" {
+			settings[key] = Redacted
+			continue
+		}
+		settings[key] = cfg.Get(key)
+	}
+	return settings
+}
+
+func isSecretSetting(key string) bool {
+	parts := strings.Split(strings.ToLower(key), ".")
+	last := parts[len(parts)-1]
+	if strings.HasSuffix(last, "_file") {
+		return false
+	}
+	for _, v := range []string{"token", "password", "key"} {
+		if strings.Contains(last, v) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+RestartValues
+текущие значения параметров которые требуют перезапуска
+*/
+func RestartValues(cfg *viper.Viper, keys []string) map[string]string {
+	values := map[string]string{}
+	for _, key := range keys {
+		values[key] = fmt.Sprint(cfg.Get(key))
+	}
+	return values
+}
+
+/*
+PendingRestart
+параметры из keys значения которых изменились с запуска (started - RestartValues при запуске),
+об измененных параметрах пишет в лог
+*/
+func PendingRestart(cfg *viper.Viper, keys []string, started map[string]string) []string {
+	var pending []string
+	current := RestartValues(cfg, keys)
+	for _, key := range keys {
+		if current[key] != started[key] {
+			pending = append(pending, key)
+			Logger.Warnw("Config change requires restart", "key", key)
+		}
+	}
+	sort.Strings(pending)
+	return pending
+}
+
+/*
+WatchConfig
+следит за файлом конфигурации и вызывает apply после каждого изменения
+без файла конфигурации ничего не делает
+*/
+func WatchConfig(cfg *viper.Viper, apply func()) {
+	if cfg.ConfigFileUsed() == "" {
+		return
+	}
+	cfg.OnConfigChange(func(e fsnotify.Event) {
+		Logger.Infow("Config file changed", "file", e.Name)
+		apply()
+	})
+	cfg.WatchConfig()
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigSettings(t *testing.T) {
+	cfg := viper.New()
+	cfg.Set("admin.token", "topsecret")
+	cfg.Set("pub.key_file", "/run/secrets/pub")
+	cfg.Set("ticker.value", 5)
+	cfg.Set("redis.password", "")
+
+	settings := ConfigSettings(cfg)
+	assert.Equal(t, Redacted, settings["admin.token"])
+	assert.Equal(t, "/run/secrets/pub", settings["pub.key_file"])
+	assert.Equal(t, 5, settings["ticker.value"])
+	assert.Equal(t, "", settings["redis.password"])
+}
+
+func TestPendingRestart(t *testing.T) {
+	cfg := viper.New()
+	cfg.Set("server.addr", "0.0.0.0:8888")
+	cfg.Set("redis.addr", "redis:6379")
+	keys := []string{"server.addr", "redis.addr"}
+	started := RestartValues(cfg, keys)
+	assert.Empty(t, PendingRestart(cfg, keys, started))
+
+	cfg.Set("redis.addr", "localhost:6379")
+	assert.Equal(t, []string{"redis.addr"}, PendingRestart(cfg, keys, started))
+}
+
+func TestAdminOnly(t *testing.T) {
+	token := ""
+	handler := AdminOnly(func() string { return token }, func(w http.ResponseWriter, r *http.Request) {})
+	req, _ := http.NewRequest("GET", "/admin/config", nil)
+	req.Header.Set("Authorization", "Bearer test-token")
+
+	w := httptest.NewRecorder()
+	handler(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// токен читается при каждом запросе
+	token = "other-token"
+	w = httptest.NewRecorder()
+	handler(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	token = "test-token"
+	w = httptest.NewRecorder()
+	handler(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
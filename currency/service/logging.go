@@ -0,0 +1,142 @@
+/*
+Package service
+общие части HTTP сервисов currency и steam
+*/
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	RequestIDHeader = "X-Request-ID"
+
+	LogFormatConsole = "console"
+	LogFormatJSON    = "json"
+)
+
+var (
+	// Logger - логгер сервиса, приложение заменяет его после настройки (log.level, log.format)
+	Logger = zap.S()
+)
+
+type loggerKey struct{}
+
+/*
+NewRequestID
+случайный идентификатор запроса
+*/
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().UTC().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}
+
+/*
+RequestLogger
+логгер запроса - все записи содержат request_id
+*/
+func RequestLogger(r *http.Request) *zap.SugaredLogger {
+	if logger, ok := r.Context().Value(loggerKey{}).(*zap.SugaredLogger); ok {
+		return logger
+	}
+	return Logger
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+func (rec *responseRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+/*
+AccessLog
+журнал запросов: метод, маршрут, статус, время выполнения, размер ответа
+X-Request-ID берется из запроса или генерируется и возвращается в ответе
+если запрос трассируется - в записи добавляется trace_id
+*/
+func AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = NewRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		logger := Logger.With("request_id", id)
+		if sc := trace.SpanContextFromContext(r.Context()); sc.HasTraceID() {
+			logger = logger.With("trace_id", sc.TraceID().String())
+		}
+		r = r.WithContext(context.WithValue(r.Context(), loggerKey{}, logger))
+
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if tpl, err := current.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+		logger.Infow("HTTP request",
+			"method", r.Method,
+			"route", route,
+			"status", rec.status,
+			"latency", time.Since(start),
+			"bytes", rec.bytes,
+			"remote", r.RemoteAddr,
+		)
+	})
+}
+
+/*
+NewLoggerConfig
+format - console (цветной, для разработки) или json (production)
+*/
+func NewLoggerConfig(format string, level zap.AtomicLevel) zap.Config {
+	var config zap.Config
+	if format == LogFormatJSON {
+		config = zap.NewProductionConfig()
+	} else {
+		config = zap.NewDevelopmentConfig()
+		config.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	}
+	config.Level = level
+	return config
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestAccessLog(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	saved := Logger
+	Logger = zap.New(core).Sugar()
+	defer func() { Logger = saved }()
+
+	router := mux.NewRouter()
+	router.Use(AccessLog)
+	router.HandleFunc("/currency/{type}", func(w http.ResponseWriter, r *http.Request) {
+		RequestLogger(r).Debugw("inside handler")
+		w.WriteHeader(http.StatusTeapot)
+		io.WriteString(w, "hello")
+	})
+
+	req, _ := http.NewRequest("GET", "/currency/BTCUSD", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "req-1", w.Header().Get(RequestIDHeader))
+
+	entries := logs.All()
+	if assert.Equal(t, 2, len(entries)) {
+		assert.Equal(t, "req-1", entries[0].ContextMap()["request_id"])
+		access := entries[1].ContextMap()
+		assert.Equal(t, "req-1", access["request_id"])
+		assert.Equal(t, "/currency/{type}", access["route"])
+		assert.Equal(t, int64(http.StatusTeapot), access["status"])
+		assert.Equal(t, int64(5), access["bytes"])
+	}
+
+	req, _ = http.NewRequest("GET", "/currency/BTCUSD", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 32, len(w.Header().Get(RequestIDHeader)))
+}
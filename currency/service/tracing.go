@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	TracingExporterNone   = "none"
+	TracingExporterStdout = "stdout"
+	TracingExporterOTLP   = "otlp"
+)
+
+/*
+TracingConfig
+service - имя сервиса в трассах (currency, steam)
+exporter - none, stdout (для локального запуска) или otlp (коллектор по HTTP, endpoint host:port)
+sample - доля запросов для которых пишутся трассы (0..1)
+*/
+type TracingConfig struct {
+	Service  string
+	Exporter string
+	Endpoint string
+	Insecure bool
+	Sample   float64
+}
+
+/*
+InitTracing
+настраивает экспорт трасс и передачу контекста между сервисами (W3C traceparent)
+возвращает функцию для отправки оставшихся трасс при остановке
+*/
+func InitTracing(cfg TracingConfig) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch strings.ToLower(cfg.Exporter) {
+	case "", TracingExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case TracingExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case TracingExporterOTLP:
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Endpoint)}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(context.Background(), opts...)
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %s", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.Sample))),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", cfg.Service))),
+	)
+	otel.SetTracerProvider(provider)
+	Logger.Infow("Tracing enabled", "exporter", cfg.Exporter, "endpoint", cfg.Endpoint)
+	return provider.Shutdown, nil
+}
+
+/*
+TraceHTTP
+middleware - span на каждый запрос, имя - метод и маршрут (GET /currency/{type})
+контекст трассы берется из заголовков запроса
+*/
+func TraceHTTP(service string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return otelhttp.NewHandler(next, service, otelhttp.WithSpanNameFormatter(func(operation string, r *http.Request) string {
+			if current := mux.CurrentRoute(r); current != nil {
+				if tpl, err := current.GetPathTemplate(); err == nil {
+					return r.Method + " " + tpl
+				}
+			}
+			return r.Method + " " + r.URL.Path
+		}))
+	}
+}
+
+/*
+EndSpan
+завершает span, ошибка записывается в span
+expected - ошибки которые не считаются ошибкой операции (redis.Nil, mgo.ErrNotFound)
+*/
+func EndSpan(span trace.Span, err error, expected ...error) {
+	if err != nil && !isExpected(err, expected) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func isExpected(err error, expected []error) bool {
+	for _, e := range expected {
+		if err == e {
+			return true
+		}
+	}
+	return false
+}
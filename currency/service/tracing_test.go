@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestTraceHTTP(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	savedProvider := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTracerProvider(savedProvider)
+
+	core, logs := observer.New(zapcore.DebugLevel)
+	savedLogger := Logger
+	Logger = zap.New(core).Sugar()
+	defer func() { Logger = savedLogger }()
+
+	router := mux.NewRouter()
+	router.Use(TraceHTTP("currency"), AccessLog)
+	router.HandleFunc("/currency/{type}", func(w http.ResponseWriter, r *http.Request) {
+		_, span := otel.Tracer("test").Start(r.Context(), "inside handler")
+		span.End()
+	})
+
+	// контекст трассы приходит от steam в заголовке traceparent
+	req, _ := http.NewRequest("GET", "/currency/BTCUSD", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if assert.Equal(t, 2, len(spans)) {
+		assert.Equal(t, "inside handler", spans[0].Name())
+		assert.Equal(t, "GET /currency/{type}", spans[1].Name())
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[1].SpanContext().TraceID().String())
+		assert.Equal(t, spans[1].SpanContext().SpanID(), spans[0].Parent().SpanID())
+	}
+
+	entries := logs.All()
+	if assert.Equal(t, 1, len(entries)) {
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", entries[0].ContextMap()["trace_id"])
+	}
+}
+
+func TestEndSpan(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+	notFound := errors.New("not found")
+
+	_, span := tracer.Start(context.Background(), "expected")
+	EndSpan(span, notFound, notFound)
+	_, span = tracer.Start(context.Background(), "failed")
+	EndSpan(span, errors.New("connection refused"), notFound)
+
+	spans := recorder.Ended()
+	if assert.Equal(t, 2, len(spans)) {
+		assert.Equal(t, codes.Unset, spans[0].Status().Code)
+		assert.Equal(t, codes.Error, spans[1].Status().Code)
+	}
+}
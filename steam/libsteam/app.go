@@ -1,12 +1,14 @@
 package libsteam
 
 import (
+	"context"
 	"strings"
+	"sync"
 
+	"github.com/SArtemJ/CurrencyGameExample/currency/service"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
-	"go.uber.org/zap/zapcore"
 )
 
 const (
@@ -25,6 +27,11 @@ type Application struct {
 	serverAPIEndpoint string
 	storageUri        string
 	storageName       string
+	currencyAPI       string
+
+	logLevel zap.AtomicLevel
+	configM  sync.Mutex
+	started  map[string]string
 
 	rootCmd *cobra.Command
 }
@@ -40,9 +47,18 @@ func (app *Application) InitCommands() {
 		Use:   "gameapp",
 		Short: "game API",
 		Long:  "game info API",
-		Run: func(cmd *cobra.Command, args []string) {
+		RunE: func(cmd *cobra.Command, args []string) error {
 			app.Init()
+			shutdown, err := service.InitTracing(app.TracingConfig())
+			if err != nil {
+				Logger.Errorw("Can't init tracing", "err", err)
+				return err
+			}
+			defer shutdown(context.Background())
+
+			app.WatchConfig()
 			app.Server.Run()
+			return nil
 		},
 	}
 
@@ -50,6 +66,7 @@ func (app *Application) InitCommands() {
 	app.rootCmd.PersistentFlags().StringVarP(&app.storageUri, "storage_addr", "s", "localhost", "MongoDB server")
 	app.rootCmd.PersistentFlags().StringVar(&app.storageName, "storage_name", "gamedb", "MongoDB database")
 	app.rootCmd.PersistentFlags().StringVarP(&app.serverAPIEndpoint, "api", "a", "", "API URL endpoint")
+	app.rootCmd.PersistentFlags().StringVarP(&app.currencyAPI, "currency_api", "c", "", "currency service API URL")
 }
 
 func (app *Application) InitConfig(configName, envPrefix string) {
@@ -69,11 +86,28 @@ func (app *Application) InitConfig(configName, envPrefix string) {
 	//для локального localhost
 	cfg.SetDefault("storage.addr", "steam_db_1")
 	cfg.BindPFlag("storage.addr", app.rootCmd.PersistentFlags().Lookup("storage_addr"))
+	//для docker http://currency_app_1:8888/api/
+	//для локального http://localhost:8888/api/
+	cfg.SetDefault("currency.addr", "http://currency_app_1:8888/api/")
+	cfg.BindPFlag("currency.addr", app.rootCmd.PersistentFlags().Lookup("currency_api"))
+	cfg.SetDefault("currency.timeout", "10s")
+	cfg.SetDefault("admin.token", "")
+	cfg.SetDefault("log.level", "debug")
+	cfg.SetDefault("log.format", service.LogFormatConsole)
+	cfg.SetDefault("tracing.exporter", service.TracingExporterNone)
+	cfg.SetDefault("tracing.endpoint", "localhost:4318")
+	cfg.SetDefault("tracing.insecure", true)
+	cfg.SetDefault("tracing.sample", 1.0)
 
 	cfg.SetConfigName(configName)
 	cfg.AddConfigPath("/etc/")
 	cfg.AddConfigPath("$HOME/")
 	cfg.AddConfigPath("./")
+	if err := cfg.ReadInConfig(); err != nil {
+		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
+			panic("Failed to read config file: " + err.Error())
+		}
+	}
 
 	app.cfg = cfg
 }
@@ -84,13 +118,17 @@ func (app *Application) GetConfig() *viper.Viper {
 
 func (app *Application) ConfigureLog() {
 
-	config := zap.NewDevelopmentConfig()
-	config.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	app.logLevel = zap.NewAtomicLevel()
+	if err := app.logLevel.UnmarshalText([]byte(app.cfg.GetString("log.level"))); err != nil {
+		panic("Bad log.level: " + app.cfg.GetString("log.level"))
+	}
+	config := service.NewLoggerConfig(app.cfg.GetString("log.format"), app.logLevel)
 	logger, err := config.Build()
 	if err != nil {
 		panic("Failed to initialize logger")
 	}
 	Logger = logger.Sugar()
+	service.Logger = Logger
 }
 
 func (app *Application) Configure(params ...string) {
@@ -113,15 +151,31 @@ func (app *Application) Init() {
 
 	app.listenAddr = app.cfg.GetString("server.addr")
 	storage := NewMongoStorage(app.cfg.GetString("storage.addr"), app.cfg.GetString("storage.name"))
-	storage.Reset()
+	if err := storage.EnsureIndexes(context.Background()); err != nil {
+		// без уникального индекса по appid синхронизация списка игр создает повторы
+		Logger.Fatalw("Can't create MongoDB indexes", "err", err)
+	}
 
 	app.Server = NewServer(MgoGameServerConfig{
-		address:   app.cfg.GetString("server.addr"),
-		apiPrefix: app.cfg.GetString("server.apiPrefix"),
-		Storage:   storage,
+		address:         app.cfg.GetString("server.addr"),
+		apiPrefix:       app.cfg.GetString("server.apiPrefix"),
+		currencyAPI:     app.cfg.GetString("currency.addr"),
+		currencyTimeout: app.cfg.GetDuration("currency.timeout"),
+		adminToken:      app.cfg.GetString("admin.token"),
+		Storage:         storage,
 	})
 }
 
+func (app *Application) TracingConfig() service.TracingConfig {
+	return service.TracingConfig{
+		Service:  ServiceName,
+		Exporter: app.cfg.GetString("tracing.exporter"),
+		Endpoint: app.cfg.GetString("tracing.endpoint"),
+		Insecure: app.cfg.GetBool("tracing.insecure"),
+		Sample:   app.cfg.GetFloat64("tracing.sample"),
+	}
+}
+
 func (app *Application) Run() {
 	if err := app.rootCmd.Execute(); err != nil {
 		panic(err)
@@ -0,0 +1,78 @@
+package libsteam
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/SArtemJ/CurrencyGameExample/currency/service"
+)
+
+/*
+RestartKeys
+параметры которые применяются только после перезапуска
+log.level и rounding применяются сразу после изменения файла конфигурации
+*/
+var RestartKeys = []string{
+	"server.addr",
+	"server.apiPrefix",
+	"storage.addr",
+	"storage.name",
+	"currency.addr",
+	"currency.timeout",
+	"admin.token",
+	"log.format",
+	"tracing.exporter",
+	"tracing.endpoint",
+	"tracing.insecure",
+	"tracing.sample",
+}
+
+/*
+WatchConfig
+следит за файлом конфигурации и применяет изменения без перезапуска
+*/
+func (app *Application) WatchConfig() {
+	app.started = service.RestartValues(app.cfg, RestartKeys)
+	app.ApplyConfig()
+	service.WatchConfig(app.cfg, app.ApplyConfig)
+}
+
+/*
+ApplyConfig
+применяет параметры которые можно менять на работающем сервере
+об измененных параметрах которые требуют перезапуска пишет в лог
+*/
+func (app *Application) ApplyConfig() {
+	app.configM.Lock()
+	defer app.configM.Unlock()
+	cfg := app.cfg
+
+	if err := app.logLevel.UnmarshalText([]byte(cfg.GetString("log.level"))); err != nil {
+		Logger.Errorw("Bad log.level - not changed", "value", cfg.GetString("log.level"))
+	}
+	if rounding, err := ParseRounding(cfg); err != nil {
+		Logger.Errorw("Bad rounding - not changed", "err", err)
+	} else if err := app.Server.Currencies.SetRounding(rounding); err != nil {
+		Logger.Errorw("Bad rounding - default rules are used", "err", err)
+	}
+
+	pending := service.PendingRestart(cfg, RestartKeys, app.started)
+	app.Server.Config.Set(cfg.ConfigFileUsed(), service.ConfigSettings(cfg), pending)
+}
+
+/*
+AdminOnly
+доступ к административным методам только с токеном admin.token (см. service.AdminOnly)
+*/
+func (server *MgoGameServer) AdminOnly(next http.HandlerFunc) http.HandlerFunc {
+	return service.AdminOnly(func() string { return server.AdminToken }, next)
+}
+
+/*
+GetConfig
+GET /admin/config - действующие параметры
+*/
+func (server *MgoGameServer) GetConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	json.NewEncoder(w).Encode(server.Config.Get())
+}
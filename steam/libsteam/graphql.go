@@ -0,0 +1,277 @@
+package libsteam
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/SArtemJ/CurrencyGameExample/currency/currencyclient"
+	"github.com/SArtemJ/CurrencyGameExample/currency/money"
+	"github.com/SArtemJ/CurrencyGameExample/currency/service"
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/relay"
+)
+
+/*
+GamesPageSize
+игр на странице games по умолчанию, MaxGamesPageSize - максимум
+*/
+const (
+	GamesPageSize    = 20
+	MaxGamesPageSize = 100
+)
+
+/*
+GraphQLSchema
+схема GraphQL запросов POST /graphql
+цены считаются по базовой стоимости игры в USD и текущим курсам,
+курсы одного запроса получаются через RateLoader - одна пара запрашивается не больше одного раза
+*/
+const GraphQLSchema = `
+schema {
+	query: Query
+}
+
+type Query {
+	# игра по appid, стоимость в USD обновляется из Steam
+	game(appid: Int!): Game
+	# игры по части названия без delisted, страницы с 1
+	games(search: String, page: Int = 1, limit: Int = 20): GamePage!
+	# курсы пар, без pairs - все курсы
+	rates(pairs: [String!]): [Rate!]!
+}
+
+type Game {
+	appid: Int!
+	name: String!
+	# игры нет в последнем списке Steam
+	delisted: Boolean!
+	# null если стоимость игры в USD еще не известна
+	price(currency: String = "USD"): Price
+	prices(currencies: [String!]): [Price!]!
+}
+
+type Price {
+	currency: String!
+	amount: String!
+	display: String!
+	# формат языка locale, по умолчанию - язык запроса (locale, Accept-Language)
+	formatted(locale: String): String!
+}
+
+type GamePage {
+	total: Int!
+	page: Int!
+	items: [Game!]!
+}
+
+type Rate {
+	pair: String!
+	# null если курса нет
+	value: String
+}
+`
+
+type graphQLLocaleKey struct{}
+
+/*
+GraphQL
+POST /graphql - запрос GraphQL ({"query": "...", "variables": {...}})
+*/
+func (server *MgoGameServer) GraphQL(w http.ResponseWriter, r *http.Request) {
+	logger := service.RequestLogger(r)
+	ctx, loader := WithRateLoader(r.Context(), server.CurrencyAPI)
+	locale, _ := RequestLocale(r)
+	ctx = context.WithValue(ctx, graphQLLocaleKey{}, locale)
+
+	server.graphQL.ServeHTTP(w, r.WithContext(ctx))
+	logger.Debugw("GraphQL request", "currency API requests", loader.Requests())
+}
+
+func newGraphQLHandler(server *MgoGameServer) *relay.Handler {
+	schema := graphql.MustParseSchema(GraphQLSchema, &graphQLResolver{server: server})
+	return &relay.Handler{Schema: schema}
+}
+
+type graphQLResolver struct {
+	server *MgoGameServer
+}
+
+func (r *graphQLResolver) Game(ctx context.Context, args struct{ Appid int32 }) *gameResolver {
+	appID := strconv.Itoa(int(args.Appid))
+	r.server.GetDefaultGameCostFromSteam(ctx, appID)
+	app, ok := r.server.Storage.CheckAndReturnGameInDB(ctx, appID)
+	if !ok {
+		return nil
+	}
+	return &gameResolver{server: r.server, app: app.App}
+}
+
+func (r *graphQLResolver) Games(ctx context.Context, args struct {
+	Search *string
+	Page   int32
+	Limit  int32
+}) (*gamePageResolver, error) {
+	if args.Page < 1 {
+		return nil, fmt.Errorf("page must be positive")
+	}
+	if args.Limit < 1 || args.Limit > MaxGamesPageSize {
+		return nil, fmt.Errorf("limit must be between 1 and %d", MaxGamesPageSize)
+	}
+	search := ""
+	if args.Search != nil {
+		search = *args.Search
+	}
+
+	limit := int(args.Limit)
+	games, total, err := r.server.Storage.FindGames(ctx, search, (int(args.Page)-1)*limit, limit)
+	if err != nil {
+		Logger.Debugw("Can't find games in MongoDB", "search", search, "err", err)
+		return nil, fmt.Errorf("can't find games")
+	}
+	page := &gamePageResolver{total: int32(total), page: args.Page}
+	for _, app := range games {
+		page.items = append(page.items, &gameResolver{server: r.server, app: app})
+	}
+	return page, nil
+}
+
+func (r *graphQLResolver) Rates(ctx context.Context, args struct{ Pairs *[]string }) ([]*rateResolver, error) {
+	api := r.server.currencyAPI(ctx)
+	result := []*rateResolver{}
+	if args.Pairs == nil {
+		rates, err := api.Rates(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for pair, value := range rates {
+			result = append(result, &rateResolver{pair: pair, value: value})
+		}
+		sort.Slice(result, func(i, j int) bool { return result[i].pair < result[j].pair })
+		return result, nil
+	}
+
+	for _, pair := range *args.Pairs {
+		value, err := api.Rate(ctx, pair)
+		if err != nil && err != currencyclient.ErrNoRate {
+			return nil, err
+		}
+		result = append(result, &rateResolver{pair: pair, value: value})
+	}
+	return result, nil
+}
+
+type gameResolver struct {
+	server *MgoGameServer
+	app    AppsStruct
+}
+
+func (r *gameResolver) Appid() int32 {
+	return int32(r.app.Appid)
+}
+
+func (r *gameResolver) Name() string {
+	return r.app.Name
+}
+
+func (r *gameResolver) Delisted() bool {
+	return r.app.Delisted
+}
+
+func (r *gameResolver) Price(ctx context.Context, args struct{ Currency string }) (*priceResolver, error) {
+	if !IsSupportedCurrency(args.Currency) {
+		return nil, fmt.Errorf("unsupported currency %s", args.Currency)
+	}
+	if r.app.USD.IsZero() {
+		return nil, nil
+	}
+	price, ok := r.server.PriceIn(ctx, r.app.USD, args.Currency)
+	if !ok {
+		return nil, fmt.Errorf("can't get rate for %s", args.Currency)
+	}
+	return &priceResolver{code: args.Currency, amount: price, symbol: r.server.Currencies.Symbol(args.Currency)}, nil
+}
+
+func (r *gameResolver) Prices(ctx context.Context, args struct{ Currencies *[]string }) ([]*priceResolver, error) {
+	codes := SupportedCurrencies
+	if args.Currencies != nil {
+		codes = *args.Currencies
+	}
+	result := []*priceResolver{}
+	for _, code := range codes {
+		price, err := r.Price(ctx, struct{ Currency string }{code})
+		if err != nil {
+			return nil, err
+		}
+		if price != nil {
+			result = append(result, price)
+		}
+	}
+	return result, nil
+}
+
+type priceResolver struct {
+	code   string
+	amount money.Amount
+	symbol string
+}
+
+func (r *priceResolver) Currency() string {
+	return r.code
+}
+
+func (r *priceResolver) Amount() string {
+	return r.amount.String()
+}
+
+func (r *priceResolver) Display() string {
+	return r.amount.Format(r.code)
+}
+
+func (r *priceResolver) Formatted(ctx context.Context, args struct{ Locale *string }) string {
+	locale, ok := ctx.Value(graphQLLocaleKey{}).(Locale)
+	if !ok {
+		locale = Locales[0]
+	}
+	if args.Locale != nil {
+		locale = MatchLocale(*args.Locale)
+	}
+	return locale.Format(r.amount, r.code, r.symbol)
+}
+
+type gamePageResolver struct {
+	total int32
+	page  int32
+	items []*gameResolver
+}
+
+func (r *gamePageResolver) Total() int32 {
+	return r.total
+}
+
+func (r *gamePageResolver) Page() int32 {
+	return r.page
+}
+
+func (r *gamePageResolver) Items() []*gameResolver {
+	return r.items
+}
+
+type rateResolver struct {
+	pair  string
+	value money.Amount
+}
+
+func (r *rateResolver) Pair() string {
+	return r.pair
+}
+
+func (r *rateResolver) Value() *string {
+	if r.value.IsZero() {
+		return nil
+	}
+	v := r.value.String()
+	return &v
+}
@@ -0,0 +1,255 @@
+package libsteam
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SArtemJ/CurrencyGameExample/currency/currencyclient"
+	"github.com/SArtemJ/CurrencyGameExample/currency/money"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingAPI запоминает какие пары запрашивались у currency API
+type countingAPI struct {
+	currencyclient.API
+	m     sync.Mutex
+	calls int
+	pairs []string
+}
+
+func (c *countingAPI) record(pairs ...string) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.calls++
+	c.pairs = append(c.pairs, pairs...)
+}
+
+func (c *countingAPI) Rate(ctx context.Context, pair string) (money.Amount, error) {
+	c.record(pair)
+	return c.API.Rate(ctx, pair)
+}
+
+func (c *countingAPI) Snapshot(ctx context.Context, pairs ...string) (*currencyclient.Snapshot, error) {
+	c.record(pairs...)
+	return c.API.Snapshot(ctx, pairs...)
+}
+
+func (c *countingAPI) Rates(ctx context.Context) (map[string]money.Amount, error) {
+	c.record("*")
+	return c.API.Rates(ctx)
+}
+
+func (c *countingAPI) requested() []string {
+	c.m.Lock()
+	defer c.m.Unlock()
+	pairs := append([]string{}, c.pairs...)
+	sort.Strings(pairs)
+	return pairs
+}
+
+func newCountingAPI() *countingAPI {
+	return &countingAPI{API: currencyclient.NewFake(map[string]money.Amount{
+		"BTCUSD": money.MustParse("6512.37"),
+		"ETHUSD": money.MustParse("470"),
+		"BTCEUR": money.MustParse("5570.11"),
+		"BTCRUB": money.MustParse("400000"),
+		"USDEUR": money.MustParse("0.86"),
+		"USDRUB": money.Zero,
+	})}
+}
+
+func TestRateLoader(t *testing.T) {
+	api := newCountingAPI()
+	ctx, loader := WithRateLoader(context.Background(), api)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		for _, pair := range []string{"BTCUSD", "BTCEUR"} {
+			wg.Add(1)
+			go func(pair string) {
+				defer wg.Done()
+				v, err := loader.Rate(ctx, pair)
+				assert.NoError(t, err)
+				assert.False(t, v.IsZero())
+			}(pair)
+		}
+	}
+	wg.Wait()
+	assert.Equal(t, 1, api.calls)
+	assert.Equal(t, []string{"BTCEUR", "BTCUSD"}, api.requested())
+
+	// в запрос уходят только новые пары, нулевой курс - ErrNoRate
+	snapshot, err := loader.Snapshot(ctx, "BTCUSD", "USDRUB", "ETHUSD")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"BTCEUR", "BTCUSD", "ETHUSD", "USDRUB"}, api.requested())
+	assert.Equal(t, "470", snapshot.Rates["ETHUSD"].String())
+	_, err = snapshot.Rate("USDRUB")
+	assert.Equal(t, currencyclient.ErrNoRate, err)
+
+	// неизвестная пара не мешает получить остальные пары пачки
+	snapshot, err = loader.Snapshot(ctx, "USDGBP", "BTCRUB")
+	require.NoError(t, err)
+	assert.Equal(t, "400000", snapshot.Rates["BTCRUB"].String())
+	_, err = loader.Rate(ctx, "USDGBP")
+	assert.True(t, currencyclient.IsStatus(err, http.StatusBadRequest))
+	assert.Equal(t, loader.Requests(), api.calls)
+}
+
+func TestRateLoaderSnapshotVersion(t *testing.T) {
+	api := newCountingAPI()
+	fake := api.API.(*currencyclient.Fake)
+	ctx, loader := WithRateLoader(context.Background(), api)
+
+	_, err := loader.Rate(ctx, "BTCUSD")
+	require.NoError(t, err)
+	// курсы обновились между пачками - снимок запрашивается заново целиком
+	fake.Set("BTCUSD", money.MustParse("6600"))
+	fake.Set("BTCEUR", money.MustParse("5600"))
+	snapshot, err := loader.Snapshot(ctx, "BTCUSD", "BTCEUR")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), snapshot.Version)
+	assert.Equal(t, "6600", snapshot.Rates["BTCUSD"].String())
+	assert.Equal(t, "5600", snapshot.Rates["BTCEUR"].String())
+	assert.Equal(t, 3, api.calls)
+	assert.Equal(t, loader.Requests(), api.calls)
+
+	// пары одной пачки - без повторного запроса
+	snapshot, err = loader.Snapshot(ctx, "ETHUSD", "BTCRUB")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), snapshot.Version)
+	assert.Equal(t, 4, api.calls)
+}
+
+func TestRateLoaderRates(t *testing.T) {
+	api := newCountingAPI()
+	ctx, loader := WithRateLoader(context.Background(), api)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rates, err := loader.Rates(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, "470", rates["ETHUSD"].String())
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, api.calls)
+
+	// курсы из Rates уже получены - пара не запрашивается
+	v, err := loader.Rate(ctx, "BTCEUR")
+	require.NoError(t, err)
+	assert.Equal(t, "5570.11", v.String())
+	assert.Equal(t, 1, api.calls)
+}
+
+// panicAPI паникует при запросе курсов
+type panicAPI struct {
+	currencyclient.API
+}
+
+func (panicAPI) Snapshot(ctx context.Context, pairs ...string) (*currencyclient.Snapshot, error) {
+	panic("snapshot")
+}
+
+func (panicAPI) Rates(ctx context.Context) (map[string]money.Amount, error) {
+	panic("rates")
+}
+
+func TestRateLoaderPanic(t *testing.T) {
+	ctx, loader := WithRateLoader(context.Background(), panicAPI{})
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	_, err := loader.Rate(ctx, "BTCUSD")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "panic")
+	_, err = loader.Rates(ctx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "panic")
+}
+
+func TestGraphQLPrices(t *testing.T) {
+	defer money.ResetPolicies()
+	api := newCountingAPI()
+	server := NewServer(MgoGameServerConfig{CurrencyAPI: api})
+	require.NoError(t, server.Currencies.SetCatalog(testCatalog))
+	ctx, _ := WithRateLoader(context.Background(), server.CurrencyAPI)
+
+	app := &gameResolver{server: server, app: AppsStruct{Appid: 20, Name: "Team Fortress Classic", USD: money.New(499, -2)}}
+	prices, err := app.Prices(ctx, struct{ Currencies *[]string }{&[]string{"USD", "EUR", "RUB", "BTC", "ETH"}})
+	require.NoError(t, err)
+
+	result := map[string]string{}
+	for _, p := range prices {
+		result[p.Currency()] = p.Amount()
+	}
+	assert.Equal(t, map[string]string{"USD": "4.99", "EUR": "4.29", "RUB": "306.49", "BTC": "0.00076623", "ETH": "0.01061702"}, result)
+	// каждая пара запрошена один раз
+	requested := api.requested()
+	for i := 1; i < len(requested); i++ {
+		assert.NotEqual(t, requested[i-1], requested[i])
+	}
+
+	_, err = app.Price(ctx, struct{ Currency string }{"XXX"})
+	assert.Error(t, err)
+	none, err := (&gameResolver{server: server}).Price(ctx, struct{ Currency string }{"EUR"})
+	assert.NoError(t, err)
+	assert.Nil(t, none)
+
+	locale := "ru"
+	assert.Equal(t, "306,49 ₽", strings.Replace(findPrice(prices, "RUB").Formatted(ctx, struct{ Locale *string }{&locale}), "\u00a0", " ", -1))
+	assert.Equal(t, "€4.29", findPrice(prices, "EUR").Formatted(ctx, struct{ Locale *string }{}))
+}
+
+func findPrice(prices []*priceResolver, code string) *priceResolver {
+	for _, p := range prices {
+		if p.Currency() == code {
+			return p
+		}
+	}
+	return nil
+}
+
+func TestGraphQLRates(t *testing.T) {
+	api := newCountingAPI()
+	server := NewServer(MgoGameServerConfig{CurrencyAPI: api})
+
+	body, _ := json.Marshal(map[string]string{"query": `{
+		rates(pairs: ["BTCUSD", "USDRUB"]) { pair value }
+		again: rates(pairs: ["BTCUSD"]) { value }
+	}`})
+	req, _ := http.NewRequest("POST", "/api/graphql", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var res struct {
+		Data struct {
+			Rates []struct {
+				Pair  string
+				Value *string
+			}
+			Again []struct{ Value *string }
+		}
+		Errors []interface{}
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+	assert.Empty(t, res.Errors)
+	require.Len(t, res.Data.Rates, 2)
+	assert.Equal(t, "6512.37", *res.Data.Rates[0].Value)
+	assert.Nil(t, res.Data.Rates[1].Value)
+	assert.Equal(t, "6512.37", *res.Data.Again[0].Value)
+	assert.Equal(t, []string{"BTCUSD", "USDRUB"}, api.requested())
+}
@@ -0,0 +1,126 @@
+package libsteam
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/SArtemJ/CurrencyGameExample/currency/money"
+	"golang.org/x/text/language"
+)
+
+/*
+Locale
+правила вывода цены для языка
+Decimal - разделитель дробной части, Group - разделитель разрядов,
+SymbolFirst - символ валюты перед суммой ($12.99), иначе после суммы через неразрывный пробел (12,99 €)
+*/
+type Locale struct {
+	Tag         string
+	Decimal     string
+	Group       string
+	SymbolFirst bool
+}
+
+/*
+Locales
+поддерживаемые языки, первый - язык по умолчанию
+разделители разрядов как в CLDR - неразрывный пробел для ru и узкий неразрывный пробел для fr
+*/
+var Locales = []Locale{
+	{Tag: "en", Decimal: ".", Group: ",", SymbolFirst: true},
+	{Tag: "ru", Decimal: ",", Group: "\u00a0"},
+	{Tag: "de", Decimal: ",", Group: "."},
+	{Tag: "fr", Decimal: ",", Group: "\u202f"},
+}
+
+var localeMatcher = func() language.Matcher {
+	tags := make([]language.Tag, len(Locales))
+	for i, l := range Locales {
+		tags[i] = language.Make(l.Tag)
+	}
+	return language.NewMatcher(tags)
+}()
+
+/*
+MatchLocale
+выбирает язык по списку языков в формате Accept-Language (ru-RU,ru;q=0.9,en;q=0.8)
+если подходящего языка нет - язык по умолчанию (en)
+*/
+func MatchLocale(accept string) Locale {
+	tags, _, err := language.ParseAcceptLanguage(accept)
+	if err != nil || len(tags) == 0 {
+		return Locales[0]
+	}
+	_, index, confidence := localeMatcher.Match(tags...)
+	if confidence == language.No {
+		return Locales[0]
+	}
+	return Locales[index]
+}
+
+/*
+RequestLocale
+язык запроса - параметр locale или заголовок Accept-Language
+ok = false если язык в запросе не указан
+*/
+func RequestLocale(r *http.Request) (locale Locale, ok bool) {
+	if v := r.FormValue("locale"); v != "" {
+		return MatchLocale(v), true
+	}
+	if v := r.Header.Get("Accept-Language"); v != "" {
+		return MatchLocale(v), true
+	}
+	return Locales[0], false
+}
+
+/*
+Format
+цена в формате языка (€12.99, 1 299,00 ₽), округленная по правилам валюты
+symbol - символ валюты из таблицы валют сервиса currency (см. Currencies.Symbol)
+если для валюты задана единица вывода (sat) - сумма выводится в ней после числа
+*/
+func (l Locale) Format(a money.Amount, code, symbol string) string {
+	value, unit := money.PolicyOf(code).Display(a, code)
+
+	sign := ""
+	if strings.HasPrefix(value, "-") {
+		sign, value = "-", value[1:]
+	}
+	integer, fraction := value, ""
+	if i := strings.IndexByte(value, '.'); i >= 0 {
+		integer, fraction = value[:i], value[i+1:]
+	}
+
+	var b strings.Builder
+	for i, c := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			b.WriteString(l.Group)
+		}
+		b.WriteRune(c)
+	}
+	number := b.String()
+	if fraction != "" {
+		number += l.Decimal + fraction
+	}
+
+	if unit != "" {
+		return sign + number + "\u00a0" + unit
+	}
+	if l.SymbolFirst {
+		return sign + symbol + number
+	}
+	return sign + number + "\u00a0" + symbol
+}
+
+/*
+FillFormatted
+цены игры в формате языка с символами валют из currencies, нулевые цены не выводятся
+*/
+func (a *AppsStruct) FillFormatted(l Locale, currencies *Currencies) {
+	a.Formatted = map[string]string{}
+	for _, code := range SupportedCurrencies {
+		if v := a.Price(code); !v.IsZero() {
+			a.Formatted[code] = l.Format(v, code, currencies.Symbol(code))
+		}
+	}
+}
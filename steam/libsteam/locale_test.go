@@ -0,0 +1,76 @@
+package libsteam
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/SArtemJ/CurrencyGameExample/currency/currencyclient"
+	"github.com/SArtemJ/CurrencyGameExample/currency/money"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCatalog - часть таблицы валют сервиса currency
+var testCatalog = []currencyclient.Currency{
+	{Code: "USD", Symbol: "$", MinorUnits: 2},
+	{Code: "EUR", Symbol: "€", MinorUnits: 2},
+	{Code: "GBP", Symbol: "£", MinorUnits: 2},
+	{Code: "RUB", Symbol: "₽", MinorUnits: 2},
+	{Code: "BTC", Symbol: "₿", MinorUnits: 8, Crypto: true},
+}
+
+func testCurrencies(t *testing.T) *Currencies {
+	currencies := NewCurrencies()
+	require.NoError(t, currencies.SetCatalog(testCatalog))
+	return currencies
+}
+
+func TestLocaleFormat(t *testing.T) {
+	defer money.ResetPolicies()
+	currencies := testCurrencies(t)
+	// неразрывные пробелы заменяем обычными для читаемости
+	format := func(tag string, a money.Amount, code string) string {
+		s := MatchLocale(tag).Format(a, code, currencies.Symbol(code))
+		return strings.NewReplacer("\u00a0", " ", "\u202f", " ").Replace(s)
+	}
+
+	assert.Equal(t, "€12.99", format("en-US", money.New(1299, -2), "EUR"))
+	assert.Equal(t, "$1,299.00", format("en", money.New(1299, 0), "USD"))
+	assert.Equal(t, "1 299,00 ₽", format("ru-RU", money.MustParse("1298.999"), "RUB"))
+	assert.Equal(t, "1.234.567,50 €", format("de-DE", money.MustParse("1234567.5"), "EUR"))
+	assert.Equal(t, "12,99 €", format("fr", money.New(1299, -2), "EUR"))
+	assert.Equal(t, "₿0.00199467", format("en", money.MustParse("0.001994671"), "BTC"))
+	assert.Equal(t, "-£5.00", format("en", money.MustParse("-5"), "GBP"))
+	// валюты нет в таблице - вместо символа код
+	assert.Equal(t, "0,50000000 LTC", format("ru", money.MustParse("0.5"), "LTC"))
+
+	assert.NoError(t, money.SetPolicy("BTC", money.Policy{MinorUnits: 8, Unit: "sat"}))
+	assert.Equal(t, "199 467 sat", format("ru", money.MustParse("0.001994671"), "BTC"))
+}
+
+func TestRequestLocale(t *testing.T) {
+	defer money.ResetPolicies()
+	req, _ := http.NewRequest("GET", "/api/about/20", nil)
+	_, ok := RequestLocale(req)
+	assert.False(t, ok)
+
+	req.Header.Set("Accept-Language", "ru-RU,ru;q=0.9,en-US;q=0.8")
+	locale, ok := RequestLocale(req)
+	assert.True(t, ok)
+	assert.Equal(t, "ru", locale.Tag)
+
+	req.Header.Set("Accept-Language", "ja-JP")
+	locale, _ = RequestLocale(req)
+	assert.Equal(t, "en", locale.Tag)
+
+	// параметр locale важнее заголовка
+	req, _ = http.NewRequest("GET", "/api/about/20?locale=de-AT", nil)
+	req.Header.Set("Accept-Language", "fr")
+	locale, _ = RequestLocale(req)
+	assert.Equal(t, "de", locale.Tag)
+
+	app := AppsStruct{USD: money.New(1299, -2), RUB: money.MustParse("797.18")}
+	app.FillFormatted(MatchLocale("en"), testCurrencies(t))
+	assert.Equal(t, map[string]string{"USD": "$12.99", "RUB": "₽797.18"}, app.Formatted)
+}
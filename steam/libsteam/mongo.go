@@ -1,9 +1,14 @@
 package libsteam
 
 import (
+	"context"
+	"regexp"
 	"strconv"
 	"sync"
+	"time"
 
+	"github.com/SArtemJ/CurrencyGameExample/currency/money"
+	"github.com/SArtemJ/CurrencyGameExample/currency/service"
 	mgo "gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -19,11 +24,23 @@ type AppsStruct struct {
 	ID    bson.ObjectId `bson:"_id" json:"id"`
 	Appid int           `bson:"appid" json:"appid"`
 	Name  string        `bson:"name" json:"name"`
-	USD   float64       `bson:"USD" json:"USD"`
-	EUR   float64       `bson:"EUR" json:"EUR"`
-	GBP   float64       `bson:"GBP" json:"GBP"`
-	RUB   float64       `bson:"RUB" json:"RUB"`
-	BTC   float64       `bson:"BTC" json:"BTC"`
+	USD   money.Amount  `bson:"USD" json:"USD"`
+	EUR   money.Amount  `bson:"EUR" json:"EUR"`
+	GBP   money.Amount  `bson:"GBP" json:"GBP"`
+	RUB   money.Amount  `bson:"RUB" json:"RUB"`
+	BTC   money.Amount  `bson:"BTC" json:"BTC"`
+	ETH   money.Amount  `bson:"ETH" json:"ETH"`
+	LTC   money.Amount  `bson:"LTC" json:"LTC"`
+	USDT  money.Amount  `bson:"USDT" json:"USDT"`
+
+	// игры нет в последнем списке Steam (см. SyncGames), цены сохраняются
+	Delisted bool      `bson:"delisted" json:"delisted,omitempty"`
+	SyncedAt time.Time `bson:"synced_at" json:"-"`
+
+	// цены для вывода (см. FillDisplay), в MongoDB не хранятся
+	Display map[string]string `bson:"-" json:"display,omitempty"`
+	// цены в формате языка запроса (см. FillFormatted), в MongoDB не хранятся
+	Formatted map[string]string `bson:"-" json:"formatted,omitempty"`
 }
 
 type ApplistStruct struct {
@@ -82,20 +99,13 @@ func (s *MongoStorage) Close() {
 	s.Db = nil
 }
 
-/*Reset
-очищаем БД
-*/
-func (s MongoStorage) Reset() {
-	s.Db.C(s.Collection).RemoveAll(nil)
-}
-
 /*
 CheckAndReturnGameInDB
 проверяет наличие игры с указанным id в базе Mongo
 если игра есть возвращает ее для дальнейшей работы
 appid - id игры соответсвует appid из базы Steam
 */
-func (s MongoStorage) CheckAndReturnGameInDB(appid string) (*AppsWithMutex, bool) {
+func (s MongoStorage) CheckAndReturnGameInDB(ctx context.Context, appid string) (*AppsWithMutex, bool) {
 	var app AppsWithMutex
 	appID, err := strconv.Atoi(appid)
 	if err != nil {
@@ -103,7 +113,10 @@ func (s MongoStorage) CheckAndReturnGameInDB(appid string) (*AppsWithMutex, bool
 		return &app, false
 	}
 
-	if err := s.Db.C(s.Collection).Find(bson.M{"appid": appID}).One(&app.App); err != nil {
+	span := s.mongoSpan(ctx, "find")
+	err = s.Db.C(s.Collection).Find(bson.M{"appid": appID}).One(&app.App)
+	service.EndSpan(span, err, mgo.ErrNotFound)
+	if err != nil {
 		Logger.Debugw("Can't find app in databse with", " id - ", appid)
 		return &app, false
 	}
@@ -116,8 +129,10 @@ appMongoID - id записи в базе Mongo
 field - поле которое обновляем
 value - значение которым обновляем
 */
-func (s MongoStorage) UpdateFiledByID(appMongoID bson.ObjectId, field string, value interface{}) bool {
+func (s MongoStorage) UpdateFiledByID(ctx context.Context, appMongoID bson.ObjectId, field string, value interface{}) bool {
+	span := s.mongoSpan(ctx, "update")
 	err := s.Db.C(s.Collection).Update(bson.M{"_id": appMongoID}, bson.M{"$set": bson.M{field: value}})
+	service.EndSpan(span, err, mgo.ErrNotFound)
 	if err != nil {
 		Logger.Debugw("Can't save game cost USD in mongo", err)
 		return false
@@ -125,3 +140,172 @@ func (s MongoStorage) UpdateFiledByID(appMongoID bson.ObjectId, field string, va
 	Logger.Debugw("Game from DB update success", " gameID - ", appMongoID)
 	return true
 }
+
+/*
+FindGames
+игры по части названия (без учета регистра), отсортированные по appid, без delisted
+search - часть названия, пусто - все игры
+skip, limit - пропустить skip игр и вернуть не больше limit
+возвращает игры и общее количество найденных игр
+*/
+func (s MongoStorage) FindGames(ctx context.Context, search string, skip, limit int) ([]AppsStruct, int, error) {
+	query := bson.M{"delisted": bson.M{"$ne": true}}
+	if search != "" {
+		query["name"] = bson.RegEx{Pattern: regexp.QuoteMeta(search), Options: "i"}
+	}
+
+	span := s.mongoSpan(ctx, "find")
+	total, err := s.Db.C(s.Collection).Find(query).Count()
+	if err != nil {
+		service.EndSpan(span, err, mgo.ErrNotFound)
+		return nil, 0, err
+	}
+	games := []AppsStruct{}
+	err = s.Db.C(s.Collection).Find(query).Sort("appid").Skip(skip).Limit(limit).All(&games)
+	service.EndSpan(span, err, mgo.ErrNotFound)
+	if err != nil {
+		return nil, 0, err
+	}
+	return games, total, nil
+}
+
+/*
+SyncBatch
+сколько игр записывается в MongoDB одним bulk запросом при синхронизации
+*/
+const SyncBatch = 1000
+
+/*
+SyncSummary
+итог синхронизации списка игр
+Listed - игр в списке Steam, Inserted - новых игр, Delisted - игр которых больше нет в списке
+*/
+type SyncSummary struct {
+	Listed   int
+	Inserted int
+	Delisted int
+}
+
+/*
+EnsureIndexes
+уникальный индекс по appid
+если в коллекции уже есть повторы appid (старые данные) - остается первая запись каждой игры
+*/
+func (s MongoStorage) EnsureIndexes(ctx context.Context) error {
+	span := s.mongoSpan(ctx, "ensureIndex")
+	index := mgo.Index{Key: []string{"appid"}, Unique: true}
+	err := s.Db.C(s.Collection).EnsureIndex(index)
+	if mgo.IsDup(err) {
+		if err = s.removeDuplicates(); err == nil {
+			err = s.Db.C(s.Collection).EnsureIndex(index)
+		}
+	}
+	service.EndSpan(span, err, mgo.ErrNotFound)
+	return err
+}
+
+func (s MongoStorage) removeDuplicates() error {
+	var groups []struct {
+		IDs []bson.ObjectId `bson:"ids"`
+	}
+	err := s.Db.C(s.Collection).Pipe([]bson.M{
+		{"$sort": bson.M{"_id": 1}},
+		{"$group": bson.M{"_id": "$appid", "ids": bson.M{"$push": "$_id"}, "count": bson.M{"$sum": 1}}},
+		{"$match": bson.M{"count": bson.M{"$gt": 1}}},
+	}).AllowDiskUse().All(&groups)
+	if err != nil {
+		return err
+	}
+	for _, g := range groups {
+		_, err := s.Db.C(s.Collection).RemoveAll(bson.M{"_id": bson.M{"$in": g.IDs[1:]}})
+		if err != nil {
+			return err
+		}
+	}
+	Logger.Debugw("Removed duplicate games from MongoDB", "appids", len(groups))
+	return nil
+}
+
+/*
+SyncGames
+записывает список игр Steam без удаления данных
+игры обновляются по appid (название, время синхронизации), цены существующих игр не меняются,
+новые игры добавляются с нулевыми ценами,
+игры которых нет в списке (synced_at раньше этой синхронизации) помечаются delisted, игры вернувшиеся в список - снова доступны
+пустой список ничего не помечает - скорее всего Steam вернул ошибку
+*/
+func (s MongoStorage) SyncGames(ctx context.Context, apps []AppsStruct) (SyncSummary, error) {
+	summary := SyncSummary{}
+	span := s.mongoSpan(ctx, "sync")
+	var err error
+	defer func() { service.EndSpan(span, err, mgo.ErrNotFound) }()
+
+	c := s.Db.C(s.Collection)
+	before, err := c.Count()
+	if err != nil {
+		return summary, err
+	}
+
+	syncedAt := time.Now().UTC().Truncate(time.Millisecond)
+	seen := make(map[int]bool, len(apps))
+	bulk := c.Bulk()
+	bulk.Unordered()
+	queued := 0
+	for _, app := range apps {
+		if seen[app.Appid] {
+			continue
+		}
+		seen[app.Appid] = true
+
+		onInsert := bson.M{}
+		for _, code := range SupportedCurrencies {
+			onInsert[code] = money.Zero
+		}
+		bulk.Upsert(bson.M{"appid": app.Appid}, bson.M{
+			"$set":         bson.M{"name": app.Name, "delisted": false, "synced_at": syncedAt},
+			"$setOnInsert": onInsert,
+		})
+		queued++
+		if queued == SyncBatch {
+			if _, err = bulk.Run(); err != nil {
+				return summary, err
+			}
+			bulk = c.Bulk()
+			bulk.Unordered()
+			queued = 0
+		}
+	}
+	if queued > 0 {
+		if _, err = bulk.Run(); err != nil {
+			return summary, err
+		}
+	}
+	summary.Listed = len(seen)
+
+	after, err := c.Count()
+	if err != nil {
+		return summary, err
+	}
+	summary.Inserted = after - before
+
+	if len(seen) == 0 {
+		return summary, nil
+	}
+	// только игры синхронизированные раньше - игры из более поздней синхронизации не помечаются,
+	// у старых записей synced_at нет
+	info, err := c.UpdateAll(
+		bson.M{
+			"$or": []bson.M{
+				{"synced_at": bson.M{"$lt": syncedAt}},
+				{"synced_at": bson.M{"$exists": false}},
+			},
+			"delisted": bson.M{"$ne": true},
+		},
+		bson.M{"$set": bson.M{"delisted": true}},
+	)
+	if err != nil {
+		return summary, err
+	}
+	summary.Delisted = info.Updated
+	return summary, nil
+}
@@ -0,0 +1,264 @@
+package libsteam
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SArtemJ/CurrencyGameExample/currency/currencyclient"
+	"github.com/SArtemJ/CurrencyGameExample/currency/money"
+	"github.com/spf13/viper"
+)
+
+/*
+SupportedCurrencies
+валюты в которых возвращается и хранится стоимость игры
+*/
+var SupportedCurrencies = []string{"USD", "EUR", "GBP", "RUB", "BTC", "ETH", "LTC", "USDT"}
+
+func IsSupportedCurrency(code string) bool {
+	for _, v := range SupportedCurrencies {
+		if v == code {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Price
+стоимость игры в валюте code
+*/
+func (a *AppsStruct) Price(code string) money.Amount {
+	switch code {
+	case "USD":
+		return a.USD
+	case "EUR":
+		return a.EUR
+	case "GBP":
+		return a.GBP
+	case "RUB":
+		return a.RUB
+	case "BTC":
+		return a.BTC
+	case "ETH":
+		return a.ETH
+	case "LTC":
+		return a.LTC
+	case "USDT":
+		return a.USDT
+	}
+	return money.Zero
+}
+
+func (a *AppsStruct) SetPrice(code string, value money.Amount) {
+	switch code {
+	case "USD":
+		a.USD = value
+	case "EUR":
+		a.EUR = value
+	case "GBP":
+		a.GBP = value
+	case "RUB":
+		a.RUB = value
+	case "BTC":
+		a.BTC = value
+	case "ETH":
+		a.ETH = value
+	case "LTC":
+		a.LTC = value
+	case "USDT":
+		a.USDT = value
+	}
+}
+
+/*
+FillDisplay
+цены для вывода по правилам округления валют (12.99 USD, 199467 sat), нулевые цены не выводятся
+*/
+func (a *AppsStruct) FillDisplay() {
+	a.Display = map[string]string{}
+	for _, code := range SupportedCurrencies {
+		if v := a.Price(code); !v.IsZero() {
+			a.Display[code] = v.Format(code)
+		}
+	}
+}
+
+/*
+PriceIn
+стоимость игры в валюте code по стоимости в USD, округленная по правилам валюты
+все цены которые сервер возвращает и сохраняет в MongoDB проходят через эту функцию
+false - если курс получить не удалось, такую цену нельзя сохранять
+*/
+func (server *MgoGameServer) PriceIn(ctx context.Context, basicCostInUSD money.Amount, code string) (money.Amount, bool) {
+	price, ok := basicCostInUSD, true
+	switch code {
+	case "USD":
+	case "BTC", "ETH", "LTC", "USDT":
+		price, ok = server.GetDefaultCostApp_InCrypto(ctx, basicCostInUSD, code)
+	default:
+		price, ok = server.ConvertCost(ctx, basicCostInUSD, "BTC"+code)
+	}
+	if !ok {
+		return money.Zero, false
+	}
+	return price.Round(code), true
+}
+
+/*
+RoundingOverride
+правила округления валюты из конфигурации (ключ rounding)
+
+	rounding:
+	  BTC:
+	    mode: half_even
+	    unit: sat
+
+mode - half_up (по умолчанию) или half_even, unit - единица вывода (sat, mBTC, uBTC для BTC),
+количество знаков после запятой задается только в таблице валют сервиса currency (ключ currencies)
+*/
+type RoundingOverride struct {
+	Mode string `mapstructure:"mode"`
+	Unit string `mapstructure:"unit"`
+}
+
+/*
+ParseRounding
+читает правила округления из конфигурации
+*/
+func ParseRounding(cfg *viper.Viper) (map[string]RoundingOverride, error) {
+	overrides := map[string]RoundingOverride{}
+	if err := cfg.UnmarshalKey("rounding", &overrides); err != nil {
+		return nil, err
+	}
+	return overrides, nil
+}
+
+/*
+CurrenciesRefresh
+как часто перечитывается таблица валют сервиса currency
+*/
+const CurrenciesRefresh = 5 * time.Minute
+
+/*
+Currencies
+таблица валют сервиса currency (GET /currencies) и правила округления из конфигурации
+правила округления money собираются из обоих источников и заменяются целиком (см. money.SetPolicies)
+пока таблица не загружена - количество знаков по умолчанию (money.MinorUnits)
+*/
+type Currencies struct {
+	m        sync.RWMutex
+	catalog  map[string]currencyclient.Currency
+	rounding map[string]RoundingOverride
+}
+
+func NewCurrencies() *Currencies {
+	return &Currencies{
+		catalog:  map[string]currencyclient.Currency{},
+		rounding: map[string]RoundingOverride{},
+	}
+}
+
+/*
+SetCatalog
+заменяет таблицу валют и пересобирает правила округления
+*/
+func (c *Currencies) SetCatalog(list []currencyclient.Currency) error {
+	catalog := make(map[string]currencyclient.Currency, len(list))
+	for _, info := range list {
+		catalog[strings.ToUpper(info.Code)] = info
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.catalog = catalog
+	return c.apply()
+}
+
+/*
+SetRounding
+заменяет правила округления из конфигурации
+при ошибке в правилах валюты для нее остаются правила по умолчанию
+*/
+func (c *Currencies) SetRounding(overrides map[string]RoundingOverride) error {
+	rounding := make(map[string]RoundingOverride, len(overrides))
+	for code, o := range overrides {
+		rounding[strings.ToUpper(code)] = o
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.rounding = rounding
+	return c.apply()
+}
+
+/*
+Get
+сведения о валюте из таблицы сервиса currency
+*/
+func (c *Currencies) Get(code string) (currencyclient.Currency, bool) {
+	c.m.RLock()
+	defer c.m.RUnlock()
+	info, ok := c.catalog[strings.ToUpper(code)]
+	return info, ok
+}
+
+/*
+Symbol
+символ валюты для вывода цены, для валюты без символа (или пока таблица не загружена) - ее код
+*/
+func (c *Currencies) Symbol(code string) string {
+	if info, ok := c.Get(code); ok && info.Symbol != "" {
+		return info.Symbol
+	}
+	return strings.ToUpper(code)
+}
+
+func (c *Currencies) apply() error {
+	rules := map[string]money.Policy{}
+	for code, info := range c.catalog {
+		rules[code] = money.Policy{MinorUnits: info.MinorUnits, Mode: money.RoundHalfUp}
+	}
+	for code, o := range c.rounding {
+		p, ok := rules[code]
+		if !ok {
+			p = money.DefaultPolicy(code)
+		}
+		p.Mode = money.RoundingMode(o.Mode)
+		p.Unit = o.Unit
+		rules[code] = p
+	}
+	if err := money.SetPolicies(rules); err != nil {
+		return fmt.Errorf("bad rounding: %v", err)
+	}
+	return nil
+}
+
+/*
+LoadCurrencies
+загружает таблицу валют сервиса currency
+*/
+func (server *MgoGameServer) LoadCurrencies(ctx context.Context) error {
+	list, err := server.CurrencyAPI.Currencies(ctx)
+	if err != nil {
+		return err
+	}
+	return server.Currencies.SetCatalog(list)
+}
+
+/*
+refreshCurrencies
+перечитывает таблицу валют каждые CurrenciesRefresh - изменения currencies в сервисе currency
+применяются без перезапуска
+*/
+func (server *MgoGameServer) refreshCurrencies() {
+	for {
+		ctx, span := Tracer.Start(context.Background(), "load currencies")
+		if err := server.LoadCurrencies(ctx); err != nil {
+			Logger.Errorw("Can't load currencies - previous rounding rules are used", "err", err)
+		}
+		span.End()
+		time.Sleep(CurrenciesRefresh)
+	}
+}
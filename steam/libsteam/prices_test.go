@@ -0,0 +1,80 @@
+package libsteam
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/SArtemJ/CurrencyGameExample/currency/currencyclient"
+	"github.com/SArtemJ/CurrencyGameExample/currency/money"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPriceRounding(t *testing.T) {
+	defer money.ResetPolicies()
+
+	cfg := viper.New()
+	cfg.SetConfigType("yaml")
+	require.NoError(t, cfg.ReadConfig(bytes.NewBufferString(`
+rounding:
+  USD:
+    mode: half_even
+  BTC:
+    unit: sat
+`)))
+	rounding, err := ParseRounding(cfg)
+	require.NoError(t, err)
+
+	fake := currencyclient.NewFake(map[string]money.Amount{
+		"BTCUSD": money.MustParse("6512.37"),
+		"BTCEUR": money.MustParse("5570.11"),
+		"BTCRUB": money.MustParse("400000"),
+		"USDEUR": money.MustParse("1"),
+		"USDRUB": money.MustParse("61.37"),
+	})
+	// количество знаков - из таблицы валют сервиса currency
+	fake.Catalog = []currencyclient.Currency{
+		{Code: "USD", MinorUnits: 2},
+		{Code: "BTC", MinorUnits: 8, Crypto: true},
+		{Code: "RUB", MinorUnits: 0},
+	}
+	server := NewServer(MgoGameServerConfig{CurrencyAPI: fake})
+	ctx := context.Background()
+	require.NoError(t, server.Currencies.SetRounding(rounding))
+	assert.Equal(t, int32(2), money.PolicyOf("RUB").MinorUnits)
+	require.NoError(t, server.LoadCurrencies(ctx))
+
+	// half_even для USD, half_up по умолчанию для EUR
+	priceIn := func(usd money.Amount, code string) money.Amount {
+		price, ok := server.PriceIn(ctx, usd, code)
+		require.True(t, ok, code)
+		return price
+	}
+	assert.Equal(t, "0.12", priceIn(money.MustParse("0.125"), "USD").String())
+	assert.Equal(t, "0.13", priceIn(money.MustParse("0.125"), "EUR").String())
+	assert.Equal(t, "797", priceIn(money.New(1299, -2), "RUB").String())
+
+	app := AppsStruct{}
+	for _, code := range []string{"USD", "BTC", "RUB"} {
+		app.SetPrice(code, priceIn(money.New(1299, -2), code))
+	}
+	app.FillDisplay()
+	assert.Equal(t, map[string]string{
+		"USD": "12.99 USD",
+		"BTC": "199467 sat",
+		"RUB": "797 RUB",
+	}, app.Display)
+
+	assert.Error(t, server.Currencies.SetRounding(map[string]RoundingOverride{"USD": {Unit: "sat"}}))
+	assert.Equal(t, money.RoundHalfUp, money.PolicyOf("USD").Mode)
+	assert.Equal(t, int32(0), money.PolicyOf("RUB").MinorUnits)
+	assert.Equal(t, "", money.PolicyOf("BTC").Unit)
+
+	// таблица валют недоступна - остаются прежние правила
+	fake.Err = errors.New("connection refused")
+	assert.Error(t, server.LoadCurrencies(ctx))
+	assert.Equal(t, int32(0), money.PolicyOf("RUB").MinorUnits)
+}
@@ -0,0 +1,302 @@
+package libsteam
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/SArtemJ/CurrencyGameExample/currency/currencyclient"
+	"github.com/SArtemJ/CurrencyGameExample/currency/money"
+)
+
+/*
+RateBatchWait
+сколько RateLoader ждет другие запросы курсов перед тем как запросить их одним snapshot
+*/
+const RateBatchWait = 2 * time.Millisecond
+
+/*
+RateLoader
+курсы в рамках одного запроса к серверу (GraphQL)
+курсы запрошенные одновременно получаются одним запросом snapshot к currency API,
+полученный курс запоминается - одна и та же пара не запрашивается дважды
+Snapshot возвращает курсы одного обновления - курсы из разных пачек с разными версиями запрашиваются заново
+остальные методы currencyclient.API вызываются без изменений
+*/
+type RateLoader struct {
+	currencyclient.API
+
+	ctx     context.Context
+	m       sync.Mutex
+	rates   map[string]*loadedRate
+	pending []string
+	all     *loadedRates
+	// количество запросов к currency API
+	requests int
+}
+
+type loadedRate struct {
+	done  chan struct{}
+	value money.Amount
+	// версия курсов snapshot, unknownVersion - курс получен не из snapshot
+	version int64
+	err     error
+}
+
+const unknownVersion = -1
+
+type loadedRates struct {
+	done  chan struct{}
+	rates map[string]money.Amount
+	err   error
+}
+
+type rateLoaderKey struct{}
+
+func NewRateLoader(ctx context.Context, api currencyclient.API) *RateLoader {
+	return &RateLoader{
+		API:   api,
+		ctx:   ctx,
+		rates: map[string]*loadedRate{},
+	}
+}
+
+/*
+WithRateLoader
+контекст запроса с RateLoader - через него идут все курсы которые сервер запрашивает в этом контексте
+*/
+func WithRateLoader(ctx context.Context, api currencyclient.API) (context.Context, *RateLoader) {
+	loader := NewRateLoader(ctx, api)
+	return context.WithValue(ctx, rateLoaderKey{}, loader), loader
+}
+
+/*
+currencyAPI
+currency API для контекста - RateLoader запроса если он есть
+*/
+func (server *MgoGameServer) currencyAPI(ctx context.Context) currencyclient.API {
+	if loader, ok := ctx.Value(rateLoaderKey{}).(*RateLoader); ok {
+		return loader
+	}
+	return server.CurrencyAPI
+}
+
+/*
+load
+регистрирует пару для загрузки, первая пара в пачке запускает таймер отправки
+*/
+func (l *RateLoader) load(pair string) *loadedRate {
+	l.m.Lock()
+	defer l.m.Unlock()
+	if r, ok := l.rates[pair]; ok {
+		return r
+	}
+	r := &loadedRate{done: make(chan struct{})}
+	l.rates[pair] = r
+	l.pending = append(l.pending, pair)
+	if len(l.pending) == 1 {
+		time.AfterFunc(RateBatchWait, l.dispatch)
+	}
+	return r
+}
+
+/*
+dispatch
+запрашивает накопленные пары одним snapshot
+если в пачке есть неизвестная серверу пара (400) - пары запрашиваются по одной
+паника не оставляет ожидающих без ответа - пары пачки получают ошибку
+*/
+func (l *RateLoader) dispatch() {
+	l.m.Lock()
+	pairs := l.pending
+	l.pending = nil
+	l.requests++
+	l.m.Unlock()
+
+	defer func() {
+		if p := recover(); p != nil {
+			Logger.Errorw("Rate loader panic", "pairs", pairs, "panic", p)
+			for _, pair := range pairs {
+				l.resolve(pair, money.Zero, 0, fmt.Errorf("rate loader panic: %v", p))
+			}
+		}
+	}()
+
+	snapshot, err := l.API.Snapshot(l.ctx, pairs...)
+	if err != nil && len(pairs) > 1 && currencyclient.IsStatus(err, http.StatusBadRequest) {
+		for _, pair := range pairs {
+			l.m.Lock()
+			l.requests++
+			l.m.Unlock()
+			value, err := l.API.Rate(l.ctx, pair)
+			l.resolve(pair, value, unknownVersion, err)
+		}
+		return
+	}
+	for _, pair := range pairs {
+		if err != nil {
+			l.resolve(pair, money.Zero, 0, err)
+			continue
+		}
+		value, err := snapshot.Rate(pair)
+		l.resolve(pair, value, snapshot.Version, err)
+	}
+}
+
+/*
+Requests
+количество запросов к currency API через RateLoader
+*/
+func (l *RateLoader) Requests() int {
+	l.m.Lock()
+	defer l.m.Unlock()
+	return l.requests
+}
+
+func (l *RateLoader) resolve(pair string, value money.Amount, version int64, err error) {
+	l.m.Lock()
+	r := l.rates[pair]
+	l.m.Unlock()
+	select {
+	case <-r.done:
+		// уже получен до паники
+		return
+	default:
+	}
+	r.value, r.version, r.err = value, version, err
+	close(r.done)
+}
+
+func (l *RateLoader) wait(ctx context.Context, r *loadedRate) error {
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+/*
+Rate
+курс пары через пачку запросов
+*/
+func (l *RateLoader) Rate(ctx context.Context, pair string) (money.Amount, error) {
+	r := l.load(pair)
+	if err := l.wait(ctx, r); err != nil {
+		return money.Zero, err
+	}
+	return r.value, r.err
+}
+
+/*
+Snapshot
+курсы нескольких пар, в снимок попадают только пары курс которых удалось получить
+ошибка - если не удалось получить ни одного курса
+если курсы получены в разных пачках и версии не совпадают (или версия неизвестна) -
+снимок запрашивается у currency API заново, чтобы все курсы были из одного обновления
+*/
+func (l *RateLoader) Snapshot(ctx context.Context, pairs ...string) (*currencyclient.Snapshot, error) {
+	loaded := make([]*loadedRate, len(pairs))
+	for i, pair := range pairs {
+		loaded[i] = l.load(pair)
+	}
+
+	snapshot := &currencyclient.Snapshot{Rates: map[string]money.Amount{}}
+	var firstErr error
+	mixed := false
+	for i, r := range loaded {
+		if err := l.wait(ctx, r); err != nil {
+			return nil, err
+		}
+		if r.err != nil {
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			continue
+		}
+		if len(snapshot.Rates) > 0 && (r.version != snapshot.Version || r.version == unknownVersion) {
+			mixed = true
+		}
+		snapshot.Rates[pairs[i]] = r.value
+		snapshot.Version = r.version
+	}
+	if len(snapshot.Rates) == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+	if mixed {
+		return l.reload(ctx, snapshot)
+	}
+	return snapshot, nil
+}
+
+/*
+reload
+снимок пар mixed одним запросом - курсы одного обновления
+*/
+func (l *RateLoader) reload(ctx context.Context, mixed *currencyclient.Snapshot) (*currencyclient.Snapshot, error) {
+	pairs := make([]string, 0, len(mixed.Rates))
+	for pair := range mixed.Rates {
+		pairs = append(pairs, pair)
+	}
+	l.m.Lock()
+	l.requests++
+	l.m.Unlock()
+	return l.API.Snapshot(ctx, pairs...)
+}
+
+/*
+Rates
+все курсы одним запросом, результат и полученные курсы запоминаются для следующих запросов
+одновременные вызовы ждут один запрос, после ошибки следующий вызов запрашивает курсы заново
+*/
+func (l *RateLoader) Rates(ctx context.Context) (map[string]money.Amount, error) {
+	l.m.Lock()
+	all := l.all
+	if all == nil {
+		all = &loadedRates{done: make(chan struct{})}
+		l.all = all
+		l.requests++
+		go l.loadAll(all)
+	}
+	l.m.Unlock()
+
+	select {
+	case <-all.done:
+		return all.rates, all.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (l *RateLoader) loadAll(all *loadedRates) {
+	var rates map[string]money.Amount
+	var err error
+	defer func() {
+		if p := recover(); p != nil {
+			Logger.Errorw("Rate loader panic", "pairs", "*", "panic", p)
+			rates, err = nil, fmt.Errorf("rate loader panic: %v", p)
+		}
+
+		l.m.Lock()
+		if err != nil {
+			l.all = nil
+		}
+		for pair, value := range rates {
+			if _, ok := l.rates[pair]; ok {
+				continue
+			}
+			r := &loadedRate{done: make(chan struct{}), value: value, version: unknownVersion}
+			if value.IsZero() {
+				r.err = currencyclient.ErrNoRate
+			}
+			close(r.done)
+			l.rates[pair] = r
+		}
+		all.rates, all.err = rates, err
+		l.m.Unlock()
+		close(all.done)
+	}()
+	rates, err = l.API.Rates(l.ctx)
+}
@@ -1,33 +1,46 @@
 package libsteam
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"math"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/SArtemJ/CurrencyGameExample/currency/currencyclient"
+	"github.com/SArtemJ/CurrencyGameExample/currency/money"
+	"github.com/SArtemJ/CurrencyGameExample/currency/service"
 	"github.com/gorilla/mux"
-	"gopkg.in/mgo.v2/bson"
+	"github.com/graph-gophers/graphql-go/relay"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type MgoGameServer struct {
-	Address   string
-	APIPrefix string
-	Router    *mux.Router
-	Storage   *MongoStorage
+	Address     string
+	APIPrefix   string
+	AdminToken  string
+	Router      *mux.Router
+	Storage     *MongoStorage
+	CurrencyAPI currencyclient.API
+	Currencies  *Currencies
+	Config      *service.ActiveConfig
+	graphQL     *relay.Handler
 }
 
 type MgoGameServerConfig struct {
-	address   string
-	apiPrefix string
-	Storage   *MongoStorage
-}
-
-type ReturnCurrency struct {
-	Value float64 `json:"value"`
+	address         string
+	apiPrefix       string
+	currencyAPI     string
+	currencyTimeout time.Duration
+	adminToken      string
+	Storage         *MongoStorage
+	CurrencyAPI     currencyclient.API
 }
 
 const (
@@ -45,12 +58,23 @@ func NewServer(cfg MgoGameServerConfig) *MgoGameServer {
 	if cfg.apiPrefix == "" {
 		cfg.apiPrefix = "/api/"
 	}
+	if cfg.currencyAPI == "" {
+		cfg.currencyAPI = "http://currency_app_1:8888/api/"
+	}
+	if cfg.CurrencyAPI == nil {
+		cfg.CurrencyAPI = currencyclient.NewClient(cfg.currencyAPI, cfg.currencyTimeout)
+	}
 	server := &MgoGameServer{
-		Address:   cfg.address,
-		APIPrefix: cfg.apiPrefix,
-		Router:    mux.NewRouter(),
-		Storage:   cfg.Storage,
+		Address:     cfg.address,
+		APIPrefix:   cfg.apiPrefix,
+		Router:      mux.NewRouter(),
+		Storage:     cfg.Storage,
+		CurrencyAPI: cfg.CurrencyAPI,
+		Currencies:  NewCurrencies(),
+		AdminToken:  cfg.adminToken,
+		Config:      &service.ActiveConfig{},
 	}
+	server.graphQL = newGraphQLHandler(server)
 
 	server.SetupRouter()
 	return server
@@ -63,16 +87,22 @@ func (server *MgoGameServer) GetRouter() *mux.Router {
 func (server *MgoGameServer) SetupRouter() {
 	server.Router = server.Router.PathPrefix(server.APIPrefix).Subrouter()
 	Logger.Debugf(`API endpoint "%s"`, server.APIPrefix)
+	server.Router.Use(service.TraceHTTP(ServiceName), service.AccessLog)
 
 	server.Router.HandleFunc("/game", server.GetGameCost).Methods("POST")
 	server.Router.HandleFunc("/aboutgame/{id}", server.AboutGame).Methods("GET")
 	server.Router.HandleFunc("/del/{id}", server.ClearPriceGame).Methods("DELETE")
+	server.Router.HandleFunc("/graphql", server.GraphQL).Methods("POST")
+	server.Router.HandleFunc("/admin/config", server.AdminOnly(server.GetConfig)).Methods("GET")
 }
 
 func (server *MgoGameServer) Run() {
 	Logger.Debugf(`MgoGameServer started on "%s"`, server.Address)
-	server.Storage.Reset()
-	if server.GetAllGamesSteam() == false {
+	go server.refreshCurrencies()
+	ctx, span := Tracer.Start(context.Background(), "init games")
+	ok := server.GetAllGamesSteam(ctx)
+	span.End()
+	if ok == false {
 		Logger.Debugw("Error init data about games - try again or check request address")
 	}
 	Logger.Debugw("Init game data to Mongo - ok")
@@ -82,40 +112,36 @@ func (server *MgoGameServer) Run() {
 /*GetGameCost
 Функция на POST запрос url://game
 appid - id игры соотвествует id из базы игр Steam - хранится в MongoDB
-currency - тип валюты в котором хотим получить стоимость цены игры (USD, EUR, GBP, RUB, BTC)
+currency - тип валюты в котором хотим получить стоимость цены игры (USD, EUR, GBP, RUB, BTC, ETH, LTC, USDT)
 */
 func (server *MgoGameServer) GetGameCost(w http.ResponseWriter, r *http.Request) {
+	logger := service.RequestLogger(r)
+	ctx := r.Context()
 	r.ParseForm()
 	gameID := r.Form.Get("appid")
 	currency := r.Form.Get("currency")
-	Logger.Debugw("POST request get cost game", "game id", gameID, "currency", currency)
+	logger.Debugw("POST request get cost game", "game id", gameID, "currency", currency)
 
-	if server.GetDefaultGameCostFromSteam(gameID) == true {
-		if app, ok := server.Storage.CheckAndReturnGameInDB(gameID); ok == true {
-			basicCost := app.App.USD * 100.00 //cent
-			costInBTC := server.GetDefaultCostApp_InBTC(basicCost)
+	if server.GetDefaultGameCostFromSteam(ctx, gameID) == true {
+		if app, ok := server.Storage.CheckAndReturnGameInDB(ctx, gameID); ok == true {
+			basicCost := app.App.USD
 
 			app.M.Lock()
 			defer app.M.Unlock()
-			switch currency {
-			case "EUR":
-				f := server.ConvertCost(basicCost, "BTCEUR") / 100.00
-				app.App.EUR = FloatFixed(f)
-				server.Storage.UpdateFiledByID(app.App.ID, "EUR", app.App.EUR)
-			case "GBP":
-				f := server.ConvertCost(basicCost, "BTCGBP") / 100.00
-				app.App.GBP = FloatFixed(f)
-				server.Storage.UpdateFiledByID(app.App.ID, "GBP", app.App.GBP)
-			case "RUB":
-				f := server.ConvertCost(basicCost, "BTCRUB") / 100.00
-				app.App.RUB = FloatFixed(f)
-				server.Storage.UpdateFiledByID(app.App.ID, "RUB", app.App.RUB)
-			case "BTC":
-				app.App.BTC = costInBTC
-				server.Storage.UpdateFiledByID(app.App.ID, "BTC", app.App.BTC)
-			case "USD":
-				app.App.USD = basicCost
-				server.Storage.UpdateFiledByID(app.App.ID, "USD", app.App.USD)
+			if IsSupportedCurrency(currency) {
+				if price, ok := server.PriceIn(ctx, basicCost, currency); ok {
+					app.App.SetPrice(currency, price)
+					server.Storage.UpdateFiledByID(ctx, app.App.ID, currency, price)
+				} else {
+					logger.Debugw("Can't convert game cost, stored price is kept", "currency", currency)
+				}
+			}
+			app.App.FillDisplay()
+			// formatted зависит от Accept-Language
+			w.Header().Add("Vary", "Accept-Language")
+			if locale, ok := RequestLocale(r); ok {
+				app.App.FillFormatted(locale, server.Currencies)
+				w.Header().Set("Content-Language", locale.Tag)
 			}
 			w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 			json.NewEncoder(w).Encode(app.App)
@@ -124,35 +150,43 @@ func (server *MgoGameServer) GetGameCost(w http.ResponseWriter, r *http.Request)
 	} else {
 		w.WriteHeader(http.StatusNoContent)
 		io.WriteString(w, "No game info please try again")
-		Logger.Debugw("Not exist game in Mongo DB")
+		logger.Debugw("Not exist game in Mongo DB")
 	}
 }
 
 func (server *MgoGameServer) AboutGame(w http.ResponseWriter, r *http.Request) {
+	logger := service.RequestLogger(r)
+	ctx := r.Context()
 	appID := mux.Vars(r)["id"]
-	if app, ok := server.Storage.CheckAndReturnGameInDB(appID); ok == true {
+	if app, ok := server.Storage.CheckAndReturnGameInDB(ctx, appID); ok == true {
 		app.M.Lock()
 		defer app.M.Unlock()
+		app.App.FillDisplay()
+		w.Header().Add("Vary", "Accept-Language")
+		if locale, ok := RequestLocale(r); ok {
+			app.App.FillFormatted(locale, server.Currencies)
+			w.Header().Set("Content-Language", locale.Tag)
+		}
 		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 		json.NewEncoder(w).Encode(app.App)
 		w.WriteHeader(http.StatusOK)
 	}
 	w.WriteHeader(http.StatusNoContent)
 	io.WriteString(w, "No game info please try again")
-	Logger.Debugw("Not exist game in Mongo DB")
+	logger.Debugw("Not exist game in Mongo DB")
 }
 
 func (server *MgoGameServer) ClearPriceGame(w http.ResponseWriter, r *http.Request) {
+	logger := service.RequestLogger(r)
+	ctx := r.Context()
 	appID := mux.Vars(r)["id"]
-	if app, ok := server.Storage.CheckAndReturnGameInDB(appID); ok == true {
+	if app, ok := server.Storage.CheckAndReturnGameInDB(ctx, appID); ok == true {
 		app.M.Lock()
 		defer app.M.Unlock()
-		server.Storage.UpdateFiledByID(app.App.ID, "USD", 0.00)
-		server.Storage.UpdateFiledByID(app.App.ID, "EUR", 0.00)
-		server.Storage.UpdateFiledByID(app.App.ID, "GBP", 0.00)
-		server.Storage.UpdateFiledByID(app.App.ID, "RUB", 0.00)
-		server.Storage.UpdateFiledByID(app.App.ID, "BTC", 0.00)
-		Logger.Debugw("Game price was reset to zero values", " id ", app.App.Appid)
+		for _, code := range SupportedCurrencies {
+			server.Storage.UpdateFiledByID(ctx, app.App.ID, code, money.Zero)
+		}
+		logger.Debugw("Game price was reset to zero values", " id ", app.App.Appid)
 	}
 }
 
@@ -160,40 +194,79 @@ func (server *MgoGameServer) ClearPriceGame(w http.ResponseWriter, r *http.Reque
 GetDefaultCostApp_InBTC
 стоимость игры в BTC по курсу BTC - USD
 basicCostInUSD - стоимость игры в USD
+false - если курс получить не удалось
 */
-func (server *MgoGameServer) GetDefaultCostApp_InBTC(basicCostInUSD float64) float64 {
-	costAppInBTC := 0.00
-	if v, ok := server.RequestToCurrencyAPI("BTCUSD"); ok == true {
-		costAppInBTC = basicCostInUSD / v //game cost in BTC
+func (server *MgoGameServer) GetDefaultCostApp_InBTC(ctx context.Context, basicCostInUSD money.Amount) (money.Amount, bool) {
+	return server.GetDefaultCostApp_InCrypto(ctx, basicCostInUSD, "BTC")
+}
+
+/*
+GetDefaultCostApp_InCrypto
+стоимость игры в криптовалюте code (BTC, ETH, LTC, USDT) по курсу code - USD
+basicCostInUSD - стоимость игры в USD
+false - если курс получить не удалось
+*/
+func (server *MgoGameServer) GetDefaultCostApp_InCrypto(ctx context.Context, basicCostInUSD money.Amount, code string) (money.Amount, bool) {
+	v, ok := server.RequestToCurrencyAPI(ctx, code+"USD")
+	if ok == false {
+		return money.Zero, false
+	}
+	costApp, err := basicCostInUSD.Div(v) //game cost in crypto
+	if err != nil {
+		Logger.Debugw("Can't convert cost", "pair", code+"USD", "err", err)
+		return money.Zero, false
 	}
-	return costAppInBTC
+	return costApp, true
 }
 
 /*
 ConvertCost
-возвращает стоимость игры в выбранной валюте по курсу BTC
+возвращает стоимость игры в выбранной валюте
+все курсы берутся одним запросом из одного обновления (snapshot)
+в первую очередь используется прямой курс USDxxx (справочный курс ECB),
+если его нет или пара не отслеживается сервисом (400) - пересчет по курсу BTC
 basicCostInUSD - стоимость игры по умолчанию в USD
-typeCost - тип валюты в которую необходимо пересчитать стоимость
+typeCost - тип валюты в которую необходимо пересчитать стоимость (BTCEUR, BTCGBP, BTCRUB)
+false - если нужных курсов нет
 */
-func (server *MgoGameServer) ConvertCost(basicCostInUSD float64, typeCost string) float64 {
-	result := 0.00
-	if v, ok := server.RequestToCurrencyAPI("BTCUSD"); ok == true {
-		sAppInBTC := basicCostInUSD / v //стоимость игры в BTC
-		if newCost, ok := server.RequestToCurrencyAPI(typeCost); ok == true {
-			//Стоимость игры в новой валюте по курсу BTC
-			result = (sAppInBTC * newCost)
-		}
+func (server *MgoGameServer) ConvertCost(ctx context.Context, basicCostInUSD money.Amount, typeCost string) (money.Amount, bool) {
+	direct := "USD" + strings.TrimPrefix(typeCost, "BTC")
+	api := server.currencyAPI(ctx)
+	snapshot, err := api.Snapshot(ctx, "BTCUSD", typeCost, direct)
+	if currencyclient.IsStatus(err, http.StatusBadRequest) {
+		snapshot, err = api.Snapshot(ctx, "BTCUSD", typeCost)
+	}
+	if err != nil {
+		Logger.Debugw("Can't get rates from currency API", "pair", typeCost, "err", err)
+		return money.Zero, false
+	}
+
+	if v, err := snapshot.Rate(direct); err == nil {
+		return basicCostInUSD.Mul(v), true
+	}
+	v, err := snapshot.Rate("BTCUSD")
+	if err != nil {
+		return money.Zero, false
 	}
-	return result
+	sAppInBTC, err := basicCostInUSD.Div(v) //стоимость игры в BTC
+	if err != nil {
+		return money.Zero, false
+	}
+	newCost, err := snapshot.Rate(typeCost)
+	if err != nil {
+		return money.Zero, false
+	}
+	//Стоимость игры в новой валюте по курсу BTC
+	return sAppInBTC.Mul(newCost), true
 }
 
 /*
 GetAllGamesSteam
 обновляем информацию о всех играх
-записываем в Mongo
+записываем в Mongo без удаления - цены уже известных игр сохраняются (см. SyncGames)
 */
-func (server *MgoGameServer) GetAllGamesSteam() bool {
-	b, ok := server.DoRequest("GET", URLGetGames)
+func (server *MgoGameServer) GetAllGamesSteam(ctx context.Context) bool {
+	b, ok := server.DoRequest(ctx, "GET", URLGetGames)
 	if ok == true {
 		var data SteamApps
 		err := json.Unmarshal(b, &data)
@@ -202,18 +275,13 @@ func (server *MgoGameServer) GetAllGamesSteam() bool {
 			return false
 		}
 
-		for _, v := range data.Applist.Apps {
-			v.ID = bson.NewObjectId()
-			v.USD = 0.00
-			v.EUR = 0.00
-			v.GBP = 0.00
-			v.RUB = 0.00
-			v.BTC = 0.00
-			if err := server.Storage.Db.C(server.Storage.Collection).Insert(v); err != nil {
-				Logger.Debugw("Can't save data info about games in MongoDB", " appid - ", err)
-				continue
-			}
+		summary, err := server.Storage.SyncGames(ctx, data.Applist.Apps)
+		if err != nil {
+			Logger.Debugw("Can't save data info about games in MongoDB", "err", err)
+			return false
 		}
+		Logger.Debugw("Games synced with Steam", "listed", summary.Listed,
+			"inserted", summary.Inserted, "delisted", summary.Delisted)
 	}
 	return ok
 }
@@ -223,15 +291,15 @@ GetDefaultGameCostFromSteam
 получает базовую стоимость игры из базы Steam в USD записывает значение в Mongo
 AppID - id игры соттветствует appid в базе Steam
 */
-func (server *MgoGameServer) GetDefaultGameCostFromSteam(AppID string) bool {
+func (server *MgoGameServer) GetDefaultGameCostFromSteam(ctx context.Context, AppID string) bool {
 	done := false
 
-	if game, ok := server.Storage.CheckAndReturnGameInDB(AppID); ok == true {
+	if game, ok := server.Storage.CheckAndReturnGameInDB(ctx, AppID); ok == true {
 		game.M.Lock()
 		defer game.M.Unlock()
 		request := fmt.Sprintf(URLGetCostGame+"?appids=%s&cc=us&filters=price_overview&type=game", AppID)
 
-		if b, ok := server.DoRequest("GET", request); ok == true {
+		if b, ok := server.DoRequest(ctx, "GET", request); ok == true {
 			data := make(map[int]SteamAppPrice)
 			err := json.Unmarshal(b, &data)
 			if err != nil {
@@ -244,14 +312,15 @@ func (server *MgoGameServer) GetDefaultGameCostFromSteam(AppID string) bool {
 				return done
 			}
 			if _, ok := data[appIDInt]; ok {
-				game.App.USD = float64(data[appIDInt].Data.Price.Final)
+				//Steam возвращает цену в центах
+				game.App.USD = money.New(int64(data[appIDInt].Data.Price.Final), -2).Round("USD")
 			} else {
 				Logger.Debugw("Not exist id in map from JSON game cost", err)
 				return done
 			}
 		}
 
-		if ok := server.Storage.UpdateFiledByID(game.App.ID, "USD", game.App.USD); ok == true {
+		if ok := server.Storage.UpdateFiledByID(ctx, game.App.ID, "USD", game.App.USD); ok == true {
 			Logger.Debugw("Defaulf cost by USD updated to game - " + game.App.Name)
 			done = true
 			return done
@@ -269,7 +338,16 @@ DoRequest
 method - тип запроса (GET/POST)
 url - адрес запроса
 */
-func (server *MgoGameServer) DoRequest(method, url string) ([]byte, bool) {
+func (server *MgoGameServer) DoRequest(ctx context.Context, method, url string) (b []byte, ok bool) {
+	ctx, span := Tracer.Start(ctx, "steam "+method, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("http.url", url)))
+	defer func() {
+		if !ok {
+			span.SetStatus(codes.Error, "request failed")
+		}
+		span.End()
+	}()
+
 	req, err := http.NewRequest(method, url, nil)
 	if err != nil {
 		Logger.Debugw("Error create request with method", " - ", method)
@@ -277,7 +355,7 @@ func (server *MgoGameServer) DoRequest(method, url string) ([]byte, bool) {
 		return nil, false
 	}
 
-	res, err := http.DefaultClient.Do(req)
+	res, err := http.DefaultClient.Do(req.WithContext(ctx))
 	if err != nil {
 		Logger.Debugw("Error response method", " - ", method)
 		Logger.Debugw("Error response request", " - ", url)
@@ -285,7 +363,8 @@ func (server *MgoGameServer) DoRequest(method, url string) ([]byte, bool) {
 	}
 
 	defer res.Body.Close()
-	b, err := ioutil.ReadAll(res.Body)
+	span.SetAttributes(attribute.Int("http.status_code", res.StatusCode))
+	b, err = ioutil.ReadAll(res.Body)
 	if err != nil {
 		Logger.Debugw("Error read esponse method", " - ", method)
 		Logger.Debugw("Error read esponse url", " - ", url)
@@ -296,36 +375,15 @@ func (server *MgoGameServer) DoRequest(method, url string) ([]byte, bool) {
 
 /*
 RequestToCurrencyAPI
-делает запрос на api круса валют
-typeCurrency - тип валюты (USD, EUR, GBP, RUB)
-возвращает стоимость 1 BTC в выбранной валюте (USD, EUR, GBP, RUB) (в центах)
+делает запрос на api курса валют
+typeCurrency - пара валют (BTCUSD, BTCEUR, USDRUB...)
+возвращает курс пары, false - если курс получить не удалось
 */
-func (server *MgoGameServer) RequestToCurrencyAPI(typeCurrency string) (float64, bool) {
-	url := fmt.Sprintf("http://currency_app_1:8888/api/currency/%s", typeCurrency)
-
-	var data ReturnCurrency
-	var ok = false
-
-	if b, ok := server.DoRequest("GET", url); ok == true {
-		err := json.Unmarshal(b, &data)
-		if err != nil {
-			Logger.Debugw("Can't parse response body to struct Go - currency game")
-			return 0.00, ok
-		}
+func (server *MgoGameServer) RequestToCurrencyAPI(ctx context.Context, typeCurrency string) (money.Amount, bool) {
+	value, err := server.currencyAPI(ctx).Rate(ctx, typeCurrency)
+	if err != nil {
+		Logger.Debugw("Can't get rate from currency API", "pair", typeCurrency, "err", err)
+		return money.Zero, false
 	}
-
-	//cent's
-	oneBTC := data.Value * 100.00
-	ok = true
-	return oneBTC, ok
-}
-
-/*
-FloatFixed
-возвращает финансовое значение в формате float,2 - 2 знака после запятой
-num - число которое нужно отформатировать
-*/
-func FloatFixed(num float64) float64 {
-	output := math.Pow(10, float64(2))
-	return float64(math.Round(num*output)) / output
+	return value, true
 }
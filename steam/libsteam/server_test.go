@@ -1,6 +1,8 @@
 package libsteam
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -8,8 +10,14 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 
+	"github.com/SArtemJ/CurrencyGameExample/currency/currencyclient"
+	"github.com/SArtemJ/CurrencyGameExample/currency/money"
+	"github.com/SArtemJ/CurrencyGameExample/currency/service"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
 )
 
 func TestServerStart(t *testing.T) {
@@ -22,10 +30,55 @@ func TestServerStart(t *testing.T) {
 	assert.Equal(t, "localhost:5555", server.Address)
 }
 
+func TestConvertCost(t *testing.T) {
+	fake := currencyclient.NewFake(map[string]money.Amount{
+		"BTCUSD": money.MustParse("6512.37"),
+		"ETHUSD": money.MustParse("470"),
+		"BTCEUR": money.MustParse("5570.11"),
+		"BTCGBP": money.MustParse("4900"),
+		"BTCRUB": money.Zero,
+		"USDEUR": money.Zero,
+		"USDGBP": money.MustParse("0.7551"),
+		"USDRUB": money.Zero,
+	})
+	server := NewServer(MgoGameServerConfig{CurrencyAPI: fake})
+	usd := money.New(1299, -2)
+	ctx := context.Background()
+
+	v, ok := server.GetDefaultCostApp_InBTC(ctx, usd)
+	assert.True(t, ok)
+	assert.Equal(t, "0.00199467", v.Round("BTC").String())
+	v, ok = server.GetDefaultCostApp_InCrypto(ctx, usd, "ETH")
+	assert.True(t, ok)
+	assert.Equal(t, "0.02763830", v.Round("ETH").StringFixed("ETH"))
+	_, ok = server.GetDefaultCostApp_InCrypto(ctx, usd, "LTC")
+	assert.False(t, ok)
+	v, ok = server.ConvertCost(ctx, usd, "BTCEUR")
+	assert.True(t, ok)
+	assert.Equal(t, "11.11", v.Round("EUR").String())
+	v, ok = server.ConvertCost(ctx, usd, "BTCGBP")
+	assert.True(t, ok)
+	assert.Equal(t, "9.81", v.Round("GBP").String())
+	_, ok = server.ConvertCost(ctx, usd, "BTCRUB")
+	assert.False(t, ok)
+	_, ok = server.PriceIn(ctx, usd, "RUB")
+	assert.False(t, ok)
+
+	// прямая пара не отслеживается - пересчет по курсу BTC
+	delete(fake.Values, "USDGBP")
+	v, ok = server.ConvertCost(ctx, usd, "BTCGBP")
+	assert.True(t, ok)
+	assert.Equal(t, "9.77", v.Round("GBP").String())
+
+	fake.Err = fmt.Errorf("currency service is down")
+	_, ok = server.ConvertCost(ctx, usd, "BTCEUR")
+	assert.False(t, ok)
+}
+
 func TestDefaultLoadSteamApp(t *testing.T) {
 	server := GetTestServer()
 
-	server.GetAllGamesSteam()
+	server.GetAllGamesSteam(context.Background())
 	i, _ := server.Storage.Db.C(server.Storage.Collection).Count()
 	assert.NotEqual(t, 0, i)
 }
@@ -33,7 +86,7 @@ func TestDefaultLoadSteamApp(t *testing.T) {
 func TestGetInfoAbouGame(t *testing.T) {
 	server := GetTestServer()
 
-	server.GetAllGamesSteam()
+	server.GetAllGamesSteam(context.Background())
 
 	request := fmt.Sprintf("http://localhost:8099/api/aboutgame/%s", "20")
 	req, _ := http.NewRequest("GET", request, nil)
@@ -46,12 +99,13 @@ func TestGetInfoAbouGame(t *testing.T) {
 	log.Println(app)
 	assert.Equal(t, 20, app.Appid)
 	assert.Equal(t, "Team Fortress Classic", app.Name)
+	assert.Equal(t, "Accept-Language", w.Header().Get("Vary"))
 }
 
 func TestGetGameCost(t *testing.T) {
 	server := GetTestServer()
 
-	server.GetAllGamesSteam()
+	server.GetAllGamesSteam(context.Background())
 
 	requestURL := fmt.Sprintf("http://localhost:8099/api/game")
 	req, _ := http.NewRequest("POST", requestURL, nil)
@@ -71,5 +125,123 @@ func TestGetGameCost(t *testing.T) {
 	log.Println(app)
 	assert.Equal(t, 20, app.Appid)
 	assert.Equal(t, "Team Fortress Classic", app.Name)
-	assert.NotEqual(t, 0.00, app.USD)
+	assert.False(t, app.USD.IsZero())
+}
+
+func TestGraphQLGames(t *testing.T) {
+	server := GetTestServer()
+
+	server.GetAllGamesSteam(context.Background())
+
+	body, _ := json.Marshal(map[string]string{"query": `{
+		game(appid: 20) { appid name price(currency: "EUR") { amount formatted(locale: "de") } }
+		games(search: "fortress", limit: 5) { total page items { appid name } }
+	}`})
+	req, _ := http.NewRequest("POST", "http://localhost:8099/api/graphql", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var res struct {
+		Data struct {
+			Game struct {
+				Appid int
+				Name  string
+				Price *struct{ Amount, Formatted string }
+			}
+			Games struct {
+				Total int
+				Page  int
+				Items []struct {
+					Appid int
+					Name  string
+				}
+			}
+		}
+	}
+	_ = json.NewDecoder(w.Body).Decode(&res)
+	assert.Equal(t, 20, res.Data.Game.Appid)
+	assert.Equal(t, "Team Fortress Classic", res.Data.Game.Name)
+	assert.NotNil(t, res.Data.Game.Price)
+	assert.Equal(t, 1, res.Data.Games.Page)
+	assert.NotEmpty(t, res.Data.Games.Items)
+	assert.True(t, len(res.Data.Games.Items) <= 5)
+}
+
+func TestSyncGames(t *testing.T) {
+	storage := *GetTestServer().Storage
+	storage.Collection = "GamesSyncTest"
+	ctx := context.Background()
+	storage.Db.C(storage.Collection).DropCollection()
+	defer storage.Db.C(storage.Collection).DropCollection()
+	assert.NoError(t, storage.EnsureIndexes(ctx))
+
+	summary, err := storage.SyncGames(ctx, []AppsStruct{{Appid: 10, Name: "Counter-Strike"}, {Appid: 20, Name: "TFC"}, {Appid: 20, Name: "TFC"}})
+	assert.NoError(t, err)
+	assert.Equal(t, SyncSummary{Listed: 2, Inserted: 2}, summary)
+
+	cs, ok := storage.CheckAndReturnGameInDB(ctx, "10")
+	assert.True(t, ok)
+	storage.UpdateFiledByID(ctx, cs.App.ID, "USD", money.New(999, -2))
+
+	summary, err = storage.SyncGames(ctx, []AppsStruct{{Appid: 10, Name: "Counter-Strike 1.6"}, {Appid: 30, Name: "Day of Defeat"}})
+	assert.NoError(t, err)
+	assert.Equal(t, SyncSummary{Listed: 2, Inserted: 1, Delisted: 1}, summary)
+
+	// цена и ID сохраняются, название обновляется
+	app, _ := storage.CheckAndReturnGameInDB(ctx, "10")
+	assert.Equal(t, cs.App.ID, app.App.ID)
+	assert.Equal(t, "Counter-Strike 1.6", app.App.Name)
+	assert.Equal(t, "9.99", app.App.USD.String())
+	assert.False(t, app.App.Delisted)
+	app, _ = storage.CheckAndReturnGameInDB(ctx, "20")
+	assert.True(t, app.App.Delisted)
+
+	// игра вернулась в список, пустой список ничего не помечает
+	// игра из более поздней синхронизации не помечается, старая запись без synced_at - помечается
+	storage.Db.C(storage.Collection).Insert(bson.M{"appid": 40, "synced_at": time.Now().Add(time.Hour)}, bson.M{"appid": 50})
+	summary, err = storage.SyncGames(ctx, []AppsStruct{{Appid: 10, Name: "Counter-Strike 1.6"}, {Appid: 20, Name: "TFC"}})
+	assert.NoError(t, err)
+	assert.Equal(t, SyncSummary{Listed: 2, Delisted: 2}, summary)
+	app, _ = storage.CheckAndReturnGameInDB(ctx, "20")
+	assert.False(t, app.App.Delisted)
+	app, _ = storage.CheckAndReturnGameInDB(ctx, "40")
+	assert.False(t, app.App.Delisted)
+	app, _ = storage.CheckAndReturnGameInDB(ctx, "50")
+	assert.True(t, app.App.Delisted)
+	summary, err = storage.SyncGames(ctx, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, SyncSummary{}, summary)
+
+	// повторы appid из старых данных удаляются при создании индекса
+	storage.Db.C(storage.Collection).DropCollection()
+	storage.Db.C(storage.Collection).Insert(bson.M{"appid": 10}, bson.M{"appid": 10}, bson.M{"appid": 20})
+	assert.NoError(t, storage.EnsureIndexes(ctx))
+	n, _ := storage.Db.C(storage.Collection).Count()
+	assert.Equal(t, 2, n)
+}
+
+func TestAdminConfig(t *testing.T) {
+	server := NewServer(MgoGameServerConfig{adminToken: "secret", CurrencyAPI: currencyclient.NewFake(nil)})
+	cfg := viper.New()
+	cfg.Set("admin.token", "secret")
+	cfg.Set("log.level", "info")
+	server.Config.Set("", service.ConfigSettings(cfg), []string{"server.addr"})
+
+	req, _ := http.NewRequest("GET", "/api/admin/config", nil)
+	w := httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.NotEmpty(t, w.Header().Get(service.RequestIDHeader))
+
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	server.GetRouter().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var result service.ReturnConfig
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, service.Redacted, result.Settings["admin.token"])
+	assert.Equal(t, "info", result.Settings["log.level"])
+	assert.Equal(t, []string{"server.addr"}, result.PendingRestart)
 }
@@ -0,0 +1,27 @@
+package libsteam
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ServiceName = "steam"
+)
+
+var (
+	Tracer = otel.Tracer("github.com/SArtemJ/CurrencyGameExample/steam/libsteam")
+)
+
+/*
+mongoSpan
+span на операцию с коллекцией MongoDB
+*/
+func (s MongoStorage) mongoSpan(ctx context.Context, op string) trace.Span {
+	_, span := Tracer.Start(ctx, "mongo "+op, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system", "mongodb"), attribute.String("db.collection", s.Collection)))
+	return span
+}